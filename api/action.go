@@ -0,0 +1,22 @@
+package api
+
+type ActionType string
+
+const (
+	ActionAssign      ActionType = "assign"
+	ActionTransition  ActionType = "transition"
+	ActionSetPriority ActionType = "set-priority"
+	ActionComment     ActionType = "comment"
+)
+
+// Action is a change that should be made to a task in its upstream tracker.
+type Action struct {
+	Type ActionType `json:"type"`
+
+	// Assignee is a team member ID or a tracker login.
+	Assignee   string   `json:"assignee,omitempty"`
+	Status     Status   `json:"status,omitempty"`
+	Resolution string   `json:"resolution,omitempty"`
+	Priority   Priority `json:"priority,omitempty"`
+	Comment    string   `json:"comment,omitempty"`
+}
@@ -1,6 +1,9 @@
 package api
 
-import "sort"
+import (
+	"sort"
+	"time"
+)
 
 type Status string
 
@@ -19,6 +22,19 @@ func (s Status) String() string {
 	return string(s)
 }
 
+func (s Status) Valid() bool {
+	switch s {
+	case StatusNew, StatusAssigned, StatusOnDev, StatusPost, StatusModified, StatusOnQA, StatusVerified, StatusClosed:
+		return true
+	}
+	return false
+}
+
+// Done reports whether the development work on the task is finished.
+func (s Status) Done() bool {
+	return s == StatusOnQA || s == StatusVerified || s == StatusClosed
+}
+
 type Priority string
 
 const (
@@ -33,8 +49,19 @@ func (p Priority) String() string {
 	return string(p)
 }
 
+func (p Priority) Valid() bool {
+	switch p {
+	case PriorityP1, PriorityP2, PriorityP3, PriorityP4, PriorityP5:
+		return true
+	}
+	return false
+}
+
 const (
 	AssigneeNone string = "NONE"
+
+	// Me is a placeholder that refers to the viewer of the task list.
+	Me string = "me"
 )
 
 type KeyValue struct {
@@ -88,19 +115,82 @@ func (l Labels) DeepCopy() Labels {
 	return clone
 }
 
+// Marker describes a local marker that is set on the task.
+type Marker struct {
+	Name      string     `json:"name"`
+	Until     *time.Time `json:"until,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	Author    string     `json:"author,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+
+	// RemovedBy and RemovedAt are set for markers in the history.
+	RemovedBy string     `json:"removedBy,omitempty"`
+	RemovedAt *time.Time `json:"removedAt,omitempty"`
+}
+
+// Pin describes a manual override of the position of the task. Ranks are
+// 1-based positions in the list before and after the pins are applied.
+type Pin struct {
+	Top      bool     `json:"top,omitempty"`
+	Position int      `json:"position,omitempty"`
+	Below    []string `json:"below,omitempty"`
+
+	ComputedRank int `json:"computedRank"`
+	Rank         int `json:"rank"`
+
+	// Conflict explains how the pin contradicts the computed order or
+	// other pins.
+	Conflict string `json:"conflict,omitempty"`
+}
+
 type Task struct {
-	ID      string `json:"id"`
-	URL     string `json:"url"`
-	Summary string `json:"summary"`
-	Labels  Labels `json:"labels"`
-	Score   int    `json:"score"`
+	ID      string   `json:"id"`
+	URL     string   `json:"url"`
+	Summary string   `json:"summary"`
+	Labels  Labels   `json:"labels"`
+	Markers []Marker `json:"markers,omitempty"`
+	Score   int      `json:"score"`
+
+	// Created is when the task was created in the tracker, if known.
+	Created *time.Time `json:"created,omitempty"`
+	// Resolved is when the task was done in the tracker, if known.
+	Resolved *time.Time `json:"resolved,omitempty"`
+
+	// LocalLabels are the labels that are set in gypd rather than in the
+	// tracker. They are included in Labels as well.
+	LocalLabels Labels `json:"localLabels,omitempty"`
+
+	// HasNotes is set if the task has local notes, NotesSnippet is the
+	// beginning of the notes.
+	HasNotes     bool   `json:"hasNotes,omitempty"`
+	NotesSnippet string `json:"notesSnippet,omitempty"`
+
+	Pin *Pin `json:"pin,omitempty"`
 }
 
 func (t *Task) DeepCopy() *Task {
-	return &Task{
-		ID:      t.ID,
-		URL:     t.URL,
-		Summary: t.Summary,
-		Labels:  t.Labels.DeepCopy(),
+	var markers []Marker
+	if t.Markers != nil {
+		markers = make([]Marker, len(t.Markers))
+		copy(markers, t.Markers)
+	}
+	clone := &Task{
+		ID:       t.ID,
+		URL:      t.URL,
+		Summary:  t.Summary,
+		Labels:   t.Labels.DeepCopy(),
+		Markers:  markers,
+		Created:  t.Created,
+		Resolved: t.Resolved,
+
+		LocalLabels:  t.LocalLabels.DeepCopy(),
+		HasNotes:     t.HasNotes,
+		NotesSnippet: t.NotesSnippet,
 	}
+	if t.Pin != nil {
+		pin := *t.Pin
+		pin.Below = append([]string(nil), pin.Below...)
+		clone.Pin = &pin
+	}
+	return clone
 }
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+type Authenticator interface {
+	// Authenticate returns the name of the user who made the request. It
+	// returns an empty name and no error if the request doesn't carry
+	// credentials that are handled by this authenticator.
+	Authenticate(r *http.Request) (string, error)
+
+	// Challenge returns the value for the WWW-Authenticate header.
+	Challenge() string
+}
+
+type contextKey struct{}
+
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// User returns the authenticated user from the context, or an empty string
+// if the request wasn't authenticated.
+func User(ctx context.Context) string {
+	user, _ := ctx.Value(contextKey{}).(string)
+	return user
+}
+
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+func unauthorized(w http.ResponseWriter, authenticators []Authenticator) {
+	seen := map[string]bool{}
+	for _, a := range authenticators {
+		challenge := a.Challenge()
+		if !seen[challenge] {
+			seen[challenge] = true
+			w.Header().Add("WWW-Authenticate", challenge)
+		}
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// Middleware rejects requests that are not accepted by any of the
+// authenticators. If no authenticators are given, all requests are allowed.
+func Middleware(authenticators ...Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(authenticators) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, a := range authenticators {
+				user, err := a.Authenticate(r)
+				if err != nil {
+					logrus.Infof("Authentication failed for %s: %v", r.RemoteAddr, err)
+					unauthorized(w, authenticators)
+					return
+				}
+				if user != "" {
+					next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+					return
+				}
+			}
+			unauthorized(w, authenticators)
+		})
+	}
+}
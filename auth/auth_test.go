@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func serve(authenticators ...Authenticator) func(r *http.Request) (int, string) {
+	handler := Middleware(authenticators...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(User(r.Context())))
+	}))
+	return func(r *http.Request) (int, string) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code, rec.Body.String()
+	}
+}
+
+func TestNoAuthenticators(t *testing.T) {
+	do := serve()
+	code, user := do(httptest.NewRequest("GET", "/", nil))
+	if code != http.StatusOK || user != "" {
+		t.Errorf("got %d %q; want 200 and no user", code, user)
+	}
+}
+
+func TestStaticTokens(t *testing.T) {
+	tokens, err := LoadStaticTokens(writeFile(t, "# comment\nalice:secret1\nbob:secret2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := serve(tokens)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer secret2")
+	if code, user := do(r); code != http.StatusOK || user != "bob" {
+		t.Errorf("got %d %q; want 200 bob", code, user)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	if code, _ := do(r); code != http.StatusUnauthorized {
+		t.Errorf("got %d; want 401", code)
+	}
+
+	if code, _ := do(httptest.NewRequest("GET", "/", nil)); code != http.StatusUnauthorized {
+		t.Errorf("got %d; want 401", code)
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("pass1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// {SHA} hash of "pass2"
+	htpasswd, err := LoadHtpasswd(writeFile(t, "alice:"+string(hash)+"\nbob:{SHA}i+UhJqb95FCnFio2UdWJu1HpV50=\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := serve(htpasswd)
+
+	testCases := []struct {
+		user, password string
+		code           int
+	}{
+		{"alice", "pass1", http.StatusOK},
+		{"alice", "pass2", http.StatusUnauthorized},
+		{"bob", "pass2", http.StatusOK},
+		{"carol", "pass1", http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.SetBasicAuth(tc.user, tc.password)
+		code, user := do(r)
+		if code != tc.code {
+			t.Errorf("%s:%s: got %d; want %d", tc.user, tc.password, code, tc.code)
+		}
+		if code == http.StatusOK && user != tc.user {
+			t.Errorf("%s:%s: got user %q", tc.user, tc.password, user)
+		}
+	}
+}
+
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   m.URL,
+			"jwks_uri": m.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test",
+				"kty": "RSA",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockIssuer) token(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	s, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestOIDC(t *testing.T) {
+	issuer := newMockIssuer(t)
+	oidc, err := NewOIDC(issuer.URL, "gypd", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := serve(oidc)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	testCases := []struct {
+		name   string
+		claims jwt.MapClaims
+		code   int
+		user   string
+	}{
+		{
+			name:   "valid",
+			claims: jwt.MapClaims{"iss": issuer.URL, "aud": "gypd", "exp": exp, "preferred_username": "alice"},
+			code:   http.StatusOK,
+			user:   "alice",
+		},
+		{
+			name:   "wrong audience",
+			claims: jwt.MapClaims{"iss": issuer.URL, "aud": "other", "exp": exp, "preferred_username": "alice"},
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "wrong issuer",
+			claims: jwt.MapClaims{"iss": "https://example.com", "aud": "gypd", "exp": exp, "preferred_username": "alice"},
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "expired",
+			claims: jwt.MapClaims{"iss": issuer.URL, "aud": "gypd", "exp": time.Now().Add(-time.Hour).Unix(), "preferred_username": "alice"},
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "no username",
+			claims: jwt.MapClaims{"iss": issuer.URL, "aud": "gypd", "exp": exp},
+			code:   http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range testCases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+issuer.token(t, tc.claims))
+		code, user := do(r)
+		if code != tc.code || (code == http.StatusOK && user != tc.user) {
+			t.Errorf("%s: got %d %q; want %d %q", tc.name, code, user, tc.code, tc.user)
+		}
+	}
+}
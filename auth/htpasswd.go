@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd authenticates requests with HTTP basic authentication against an
+// htpasswd file. Only bcrypt and SHA1 password hashes are supported.
+type Htpasswd struct {
+	hashes map[string]string
+}
+
+func LoadHtpasswd(filename string) (*Htpasswd, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := &Htpasswd{hashes: map[string]string{}}
+	scanner := bufio.NewScanner(f)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.Index(line, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected user:hash", filename, lineno)
+		}
+		h.hashes[line[:idx]] = line[idx+1:]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func checkPassword(hash, password string) error {
+	switch {
+	case strings.HasPrefix(hash, "$2y$"), strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"):
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			return ErrInvalidCredentials
+		}
+		return nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		expected := base64.StdEncoding.EncodeToString(sum[:])
+		if subtle.ConstantTimeCompare([]byte(hash[len("{SHA}"):]), []byte(expected)) != 1 {
+			return ErrInvalidCredentials
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported password hash format")
+}
+
+func (h *Htpasswd) Authenticate(r *http.Request) (string, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", nil
+	}
+	hash, ok := h.hashes[user]
+	if !ok {
+		return "", ErrInvalidCredentials
+	}
+	if err := checkPassword(hash, password); err != nil {
+		return "", fmt.Errorf("user %s: %w", user, err)
+	}
+	return user, nil
+}
+
+func (h *Htpasswd) Challenge() string {
+	return `Basic realm="gypd"`
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// OIDC authenticates requests with bearer tokens issued by an OpenID Connect
+// provider. Only RSA signing keys are supported.
+type OIDC struct {
+	issuer        string
+	clientID      string
+	usernameClaim string
+	jwksURI       string
+	client        *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	refreshedAt time.Time
+}
+
+// minKeysRefreshInterval limits how often unknown key IDs can trigger
+// reloading of the signing keys.
+const minKeysRefreshInterval = time.Minute
+
+func NewOIDC(issuer, clientID, usernameClaim string) (*OIDC, error) {
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	o := &OIDC{
+		issuer:        strings.TrimSuffix(issuer, "/"),
+		clientID:      clientID,
+		usernameClaim: usernameClaim,
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}
+
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := o.getJSON(o.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider %s: %w", issuer, err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != o.issuer {
+		return nil, fmt.Errorf("OIDC provider returned issuer %q, want %q", discovery.Issuer, o.issuer)
+	}
+	o.jwksURI = discovery.JWKSURI
+
+	if err := o.refreshKeys(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (o *OIDC) getJSON(url string, v interface{}) error {
+	resp, err := o.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+func (o *OIDC) refreshKeys() error {
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := o.getJSON(o.jwksURI, &jwks); err != nil {
+		return fmt.Errorf("failed to load OIDC signing keys: %w", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, err := decodeBigInt(key.N)
+		if err != nil {
+			return fmt.Errorf("invalid modulus for key %s: %w", key.Kid, err)
+		}
+		e, err := decodeBigInt(key.E)
+		if err != nil {
+			return fmt.Errorf("invalid exponent for key %s: %w", key.Kid, err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	}
+
+	o.mu.Lock()
+	o.keys = keys
+	o.refreshedAt = time.Now()
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *OIDC) key(kid string) (*rsa.PublicKey, error) {
+	o.mu.Lock()
+	key, ok := o.keys[kid]
+	refreshedAt := o.refreshedAt
+	o.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if time.Since(refreshedAt) < minKeysRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if err := o.refreshKeys(); err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	key, ok = o.keys[kid]
+	o.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (o *OIDC) Authenticate(r *http.Request) (string, error) {
+	tokenString := bearerToken(r)
+	if tokenString == "" {
+		return "", nil
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return o.key(kid)
+	}, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}))
+	if err != nil {
+		return "", fmt.Errorf("invalid token: %w", err)
+	}
+
+	if !claims.VerifyIssuer(o.issuer, true) {
+		return "", fmt.Errorf("invalid token issuer")
+	}
+	if !claims.VerifyAudience(o.clientID, true) {
+		return "", fmt.Errorf("invalid token audience")
+	}
+	if _, ok := claims["exp"]; !ok {
+		return "", fmt.Errorf("token has no expiration time")
+	}
+
+	user, _ := claims[o.usernameClaim].(string)
+	if user == "" {
+		return "", fmt.Errorf("token has no %s claim", o.usernameClaim)
+	}
+	return user, nil
+}
+
+func (o *OIDC) Challenge() string {
+	return `Bearer realm="gypd"`
+}
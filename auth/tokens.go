@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// StaticTokens authenticates requests with bearer tokens from a file. Each
+// line of the file has the form "user:token".
+type StaticTokens struct {
+	users  []string
+	tokens []string
+}
+
+func LoadStaticTokens(filename string) (*StaticTokens, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	st := &StaticTokens{}
+	scanner := bufio.NewScanner(f)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.Index(line, ":")
+		if idx <= 0 || idx == len(line)-1 {
+			return nil, fmt.Errorf("%s:%d: expected user:token", filename, lineno)
+		}
+		st.users = append(st.users, line[:idx])
+		st.tokens = append(st.tokens, line[idx+1:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (st *StaticTokens) Authenticate(r *http.Request) (string, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return "", nil
+	}
+	for i, t := range st.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return st.users[i], nil
+		}
+	}
+	return "", nil
+}
+
+func (st *StaticTokens) Challenge() string {
+	return `Bearer realm="gypd"`
+}
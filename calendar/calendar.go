@@ -0,0 +1,188 @@
+package calendar
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmage/gypd/config"
+)
+
+const dateFormat = "2006-01-02"
+
+// Calendar knows the team's working days, sprints and releases.
+type Calendar struct {
+	location     *time.Location
+	holidays     map[string]bool
+	sprintStart  time.Time
+	sprintLength int
+	releases     map[string]time.Time
+}
+
+func New(cfg config.CalendarConfig) (*Calendar, error) {
+	location := time.UTC
+	if cfg.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+
+	c := &Calendar{
+		location: location,
+		holidays: map[string]bool{},
+		releases: map[string]time.Time{},
+	}
+	for _, holiday := range cfg.Holidays {
+		day, err := time.ParseInLocation(dateFormat, holiday, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid holiday: %w", err)
+		}
+		c.holidays[day.Format(dateFormat)] = true
+	}
+	if cfg.Sprint != nil {
+		start, err := time.ParseInLocation(dateFormat, cfg.Sprint.Start, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sprint start: %w", err)
+		}
+		if cfg.Sprint.LengthDays <= 0 {
+			return nil, fmt.Errorf("invalid sprint length: %d", cfg.Sprint.LengthDays)
+		}
+		c.sprintStart = start
+		c.sprintLength = cfg.Sprint.LengthDays
+	}
+	for _, release := range cfg.Releases {
+		date, err := time.ParseInLocation(dateFormat, release.Date, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date of release %s: %w", release.Name, err)
+		}
+		c.releases[strings.ToLower(release.Name)] = date
+	}
+	return c, nil
+}
+
+// Location returns the team's timezone.
+func (c *Calendar) Location() *time.Location {
+	return c.location
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// IsBusinessDay reports whether t falls on a working day.
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	t = t.In(c.location)
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+	return !c.holidays[t.Format(dateFormat)]
+}
+
+// AddBusinessDays returns the time n working days after t. The time of day
+// is preserved.
+func (c *Calendar) AddBusinessDays(t time.Time, n int) time.Time {
+	t = t.In(c.location)
+	for n > 0 {
+		t = t.AddDate(0, 0, 1)
+		if c.IsBusinessDay(t) {
+			n--
+		}
+	}
+	return t
+}
+
+// nextBusinessDay returns t if it is a working day, or the next working day.
+func (c *Calendar) nextBusinessDay(t time.Time) time.Time {
+	for !c.IsBusinessDay(t) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// SprintEnd returns the first day of the sprint after the one that contains t.
+func (c *Calendar) SprintEnd(t time.Time) (time.Time, error) {
+	if c.sprintLength == 0 {
+		return time.Time{}, fmt.Errorf("sprints are not configured")
+	}
+	day := startOfDay(t.In(c.location))
+	elapsed := int(math.Round(day.Sub(c.sprintStart).Hours()/24)) % c.sprintLength
+	if elapsed < 0 {
+		elapsed += c.sprintLength
+	}
+	return day.AddDate(0, 0, c.sprintLength-elapsed), nil
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), s) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// ParseUntil resolves an expiration time relative to now. It understands
+// RFC 3339 timestamps, dates (YYYY-MM-DD), durations (+12h, +3d, +2w),
+// "tomorrow", "[next] <weekday>", "next week", "end of sprint" and names of
+// releases. Days in durations are working days. Named days resolve to the
+// beginning of the day.
+func (c *Calendar) ParseUntil(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	now = now.In(c.location)
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(dateFormat, s, c.location); err == nil {
+		return t, nil
+	}
+
+	if strings.HasPrefix(s, "+") && len(s) > 2 {
+		unit := s[len(s)-1:]
+		n, err := strconv.Atoi(s[1 : len(s)-1])
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid duration %q", s)
+		}
+		switch unit {
+		case "h":
+			return now.Add(time.Duration(n) * time.Hour), nil
+		case "d":
+			return c.AddBusinessDays(now, n), nil
+		case "w":
+			return c.nextBusinessDay(now.AddDate(0, 0, 7*n)), nil
+		}
+		return time.Time{}, fmt.Errorf("invalid duration unit in %q", s)
+	}
+
+	expr := strings.ToLower(strings.Join(strings.Fields(s), " "))
+	expr = strings.TrimPrefix(expr, "until ")
+	today := startOfDay(now)
+	switch expr {
+	case "tomorrow":
+		return c.AddBusinessDays(today, 1), nil
+	case "next week":
+		return c.nextBusinessDay(nextWeekday(today, time.Monday)), nil
+	case "end of sprint":
+		return c.SprintEnd(now)
+	}
+	if weekday, ok := parseWeekday(strings.TrimPrefix(expr, "next ")); ok {
+		return nextWeekday(today, weekday), nil
+	}
+	if date, ok := c.releases[expr]; ok {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("unable to parse %q", s)
+}
+
+// nextWeekday returns the first day after day that falls on weekday.
+func nextWeekday(day time.Time, weekday time.Weekday) time.Time {
+	days := (int(weekday) - int(day.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	return day.AddDate(0, 0, days)
+}
@@ -0,0 +1,101 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dmage/gypd/config"
+)
+
+func TestParseUntil(t *testing.T) {
+	cal, err := New(config.CalendarConfig{
+		Timezone: "Europe/Prague",
+		Holidays: []string{"2022-04-15", "2022-04-18"},
+		Sprint:   &config.SprintConfig{Start: "2022-03-28", LengthDays: 21},
+		Releases: []config.Release{{Name: "4.11 GA", Date: "2022-08-10"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prague, err := time.LoadLocation("Europe/Prague")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(day string, hour int) time.Time {
+		d, err := time.ParseInLocation(dateFormat, day, prague)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d.Add(time.Duration(hour) * time.Hour)
+	}
+
+	// Thursday before Easter.
+	now := at("2022-04-14", 15)
+	testCases := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"+12h", now.Add(12 * time.Hour)},
+		{"+1d", at("2022-04-19", 15)},
+		{"+3d", at("2022-04-21", 15)},
+		{"+1w", at("2022-04-21", 15)},
+		{"tomorrow", at("2022-04-19", 0)},
+		{"next monday", at("2022-04-18", 0)},
+		{"Friday", at("2022-04-15", 0)},
+		{"next thursday", at("2022-04-21", 0)},
+		{"next week", at("2022-04-19", 0)},
+		{"end of sprint", at("2022-04-18", 0)},
+		{"until 4.11 GA", at("2022-08-10", 0)},
+		{"2022-05-01", at("2022-05-01", 0)},
+		{"2022-05-01T10:00:00Z", time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range testCases {
+		got, err := cal.ParseUntil(tc.input, now)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+			continue
+		}
+		if !got.Equal(tc.expected) {
+			t.Errorf("%s: got %s; want %s", tc.input, got, tc.expected)
+		}
+	}
+
+	for _, input := range []string{"+3y", "+xd", "someday", "until 4.12 GA"} {
+		if _, err := cal.ParseUntil(input, now); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		after    string
+		expected string
+	}{
+		{"@daily", "2022-04-14T15:04:00Z", "2022-04-15T00:00:00Z"},
+		{"@weekly", "2022-04-14T15:04:00Z", "2022-04-18T00:00:00Z"},
+		{"30 9 * * 1-5", "2022-04-15T10:00:00Z", "2022-04-18T09:30:00Z"},
+		{"*/15 * * * *", "2022-04-14T15:04:00Z", "2022-04-14T15:15:00Z"},
+		{"0 12 1 */3 *", "2022-04-14T15:04:00Z", "2022-07-01T12:00:00Z"},
+		{"0 0 13 * 5", "2022-04-14T15:04:00Z", "2022-04-15T00:00:00Z"},
+		{"0 0 29 2 *", "2022-03-01T00:00:00Z", "2024-02-29T00:00:00Z"},
+	}
+	for _, tc := range testCases {
+		schedule, err := ParseSchedule(tc.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tc.spec, err)
+			continue
+		}
+		after, _ := time.Parse(time.RFC3339, tc.after)
+		if got := schedule.Next(after).Format(time.RFC3339); got != tc.expected {
+			t.Errorf("%s after %s: got %s; want %s", tc.spec, tc.after, got, tc.expected)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * * * 8", "*/0 * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dmage/gypd/statestore"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	from = flag.String("from", "yaml:./state.yaml", "source state store (yaml:FILE or bolt:FILE)")
+	to   = flag.String("to", "bolt:./state.db", "destination state store (yaml:FILE or bolt:FILE)")
+)
+
+func main() {
+	flag.Parse()
+
+	src, err := statestore.Open(*from)
+	if err != nil {
+		logrus.Fatalf("Failed to open %s: %v", *from, err)
+	}
+	defer src.Close()
+
+	dst, err := statestore.Open(*to)
+	if err != nil {
+		logrus.Fatalf("Failed to open %s: %v", *to, err)
+	}
+	defer dst.Close()
+
+	if err := statestore.Copy(dst, src); err != nil {
+		logrus.Fatalf("Failed to migrate state from %s to %s: %v", *from, *to, err)
+	}
+	logrus.Infof("Migrated state from %s to %s.", *from, *to)
+}
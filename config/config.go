@@ -1,7 +1,9 @@
 package config
 
 import (
+	"encoding/json"
 	"io/ioutil"
+	"time"
 
 	"github.com/dmage/gypd/api"
 	"github.com/eparis/bugzilla"
@@ -20,20 +22,185 @@ type ScoreRule struct {
 	Score int
 }
 
-func (rule ScoreRule) Match(labels []api.KeyValue) bool {
+// Match reports whether labels contain the rule's key and value. The value
+// api.Me matches the viewer's ID.
+func (rule ScoreRule) Match(labels []api.KeyValue, viewer string) bool {
+	value := rule.Value
+	if value == api.Me {
+		if viewer == "" {
+			return false
+		}
+		value = viewer
+	}
 	for _, label := range labels {
-		if label.Key == rule.Key && label.Value == rule.Value {
+		if label.Key == rule.Key && label.Value == value {
 			return true
 		}
 	}
 	return false
 }
 
+// Duration is a time.Duration that is represented as a string like "168h"
+// in config files.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// MarkerType defines how markers with the given name affect tasks.
+type MarkerType struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Hide removes marked tasks from the task list.
+	Hide bool `json:"hide,omitempty"`
+	// Flag is added as a flag label to marked tasks.
+	Flag string `json:"flag,omitempty"`
+	// AddScore is added to the score of marked tasks, then the score is
+	// multiplied by MultiplyScore, if it is set.
+	AddScore      int     `json:"addScore,omitempty"`
+	MultiplyScore float64 `json:"multiplyScore,omitempty"`
+
+	// RequireUntil rejects markers without an expiration time.
+	RequireUntil bool `json:"requireUntil,omitempty"`
+	// MaxDuration limits how long the marker can be set for. Markers
+	// without an expiration time expire after MaxDuration.
+	MaxDuration *Duration `json:"maxDuration,omitempty"`
+	// DefaultUntil is suggested by the UI as the expiration time.
+	DefaultUntil string `json:"defaultUntil,omitempty"`
+}
+
+var defaultMarkerTypes = []MarkerType{
+	{Name: "blocked", Flag: "blocked", DefaultUntil: "+12h"},
+}
+
+type Release struct {
+	Name string `json:"name"`
+	// Date is the release date in the format YYYY-MM-DD.
+	Date string `json:"date"`
+}
+
+type SprintConfig struct {
+	// Start is the first day of any sprint in the format YYYY-MM-DD.
+	Start      string `json:"start"`
+	LengthDays int    `json:"lengthDays"`
+}
+
+type CalendarConfig struct {
+	// Timezone is the IANA name of the team's timezone. Defaults to UTC.
+	Timezone string `json:"timezone"`
+	// Holidays are non-working days in the format YYYY-MM-DD.
+	Holidays []string      `json:"holidays"`
+	Sprint   *SprintConfig `json:"sprint"`
+	Releases []Release     `json:"releases"`
+}
+
+type GCConfig struct {
+	// Interval is how often the garbage collector runs. It doesn't run
+	// periodically if the interval is not set.
+	Interval *Duration `json:"interval"`
+	// Retention is how long the state of tasks that are not returned by
+	// any task source is kept. Defaults to 90 days.
+	Retention *Duration `json:"retention"`
+	// ArchiveFile receives the removed state. Defaults to
+	// ./state-archive.jsonl.
+	ArchiveFile string `json:"archiveFile"`
+}
+
+func (c GCConfig) GetRetention() time.Duration {
+	if c.Retention == nil {
+		return 90 * 24 * time.Hour
+	}
+	return c.Retention.Duration
+}
+
+func (c GCConfig) GetArchiveFile() string {
+	if c.ArchiveFile == "" {
+		return "./state-archive.jsonl"
+	}
+	return c.ArchiveFile
+}
+
+type OIDCConfig struct {
+	Issuer        string `json:"issuer"`
+	ClientID      string `json:"clientID"`
+	UsernameClaim string `json:"usernameClaim"`
+}
+
+type AuthConfig struct {
+	TokensFile   string      `json:"tokensFile"`
+	HtpasswdFile string      `json:"htpasswdFile"`
+	OIDC         *OIDCConfig `json:"oidc"`
+}
+
 type Config struct {
 	BugzillaQuery bugzilla.Query `json:"bugzillaQuery"`
 	JiraQuery     string         `json:"jiraQuery"`
 	Team          []TeamMember   `json:"team"`
 	ScoreRules    []ScoreRule    `json:"scoreRules"`
+	Auth          AuthConfig     `json:"auth"`
+	MarkerTypes   []MarkerType   `json:"markerTypes"`
+	Calendar      CalendarConfig `json:"calendar"`
+	GC            GCConfig       `json:"gc"`
+
+	// Sort lists the keys that order tasks with equal scores. Defaults to
+	// priority, status, age and ID.
+	Sort []string `json:"sort"`
+}
+
+// GetSort returns the keys that order tasks with equal scores.
+func (c *Config) GetSort() []string {
+	if len(c.Sort) == 0 {
+		return []string{"priority", "status", "age", "id"}
+	}
+	return c.Sort
+}
+
+// GetMarkerTypes returns the configured marker types and the built-in ones
+// that are not overridden by the config.
+func (c *Config) GetMarkerTypes() []MarkerType {
+	types := append([]MarkerType(nil), c.MarkerTypes...)
+	for _, d := range defaultMarkerTypes {
+		if _, ok := c.markerType(d.Name); !ok {
+			types = append(types, d)
+		}
+	}
+	return types
+}
+
+func (c *Config) markerType(name string) (MarkerType, bool) {
+	for _, t := range c.MarkerTypes {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return MarkerType{}, false
+}
+
+// GetMarkerType returns the type of markers with the given name.
+func (c *Config) GetMarkerType(name string) (MarkerType, bool) {
+	for _, t := range c.GetMarkerTypes() {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return MarkerType{}, false
 }
 
 func LoadConfig() (*Config, error) {
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// StateVersion is the version of the state schema written by this version
+// of gypd.
+const StateVersion = 8
+
+var ErrNewerStateVersion = errors.New("state is written by a newer version of gypd")
+
+// stateMigrations[i] upgrades the raw state from version i to version i+1.
+// The raw state is the state decoded as JSON into a map. Every version adds
+// data that older versions of gypd would silently drop.
+var stateMigrations = []func(state map[string]interface{}) error{
+	// Version 0 is the unversioned state. It has the same layout as version 1.
+	func(state map[string]interface{}) error {
+		return nil
+	},
+	// Version 2 adds notes on tasks.
+	func(state map[string]interface{}) error {
+		return nil
+	},
+	// Version 3 adds local labels on tasks.
+	func(state map[string]interface{}) error {
+		return nil
+	},
+	// Version 4 adds local tasks.
+	func(state map[string]interface{}) error {
+		return nil
+	},
+	// Version 5 adds recurring templates.
+	func(state map[string]interface{}) error {
+		return nil
+	},
+	// Version 6 adds pins on tasks.
+	func(state map[string]interface{}) error {
+		return nil
+	},
+	// Version 7 adds daily plans.
+	func(state map[string]interface{}) error {
+		return nil
+	},
+	// Version 8 remembers the last local task ID.
+	func(state map[string]interface{}) error {
+		return nil
+	},
+}
+
+func rawStateVersion(state map[string]interface{}) (int, error) {
+	value, ok := state["version"]
+	if !ok {
+		return 0, nil
+	}
+	version, ok := value.(float64)
+	if !ok || version < 0 || version != float64(int(version)) {
+		return 0, fmt.Errorf("invalid state version %v", value)
+	}
+	return int(version), nil
+}
+
+// MigrateState upgrades the raw state to StateVersion in place and returns
+// the version that the state had before the migration.
+func MigrateState(state map[string]interface{}) (int, error) {
+	version, err := rawStateVersion(state)
+	if err != nil {
+		return 0, err
+	}
+	if version > StateVersion {
+		return version, fmt.Errorf("%w: got version %d, the latest supported version is %d", ErrNewerStateVersion, version, StateVersion)
+	}
+	for v := version; v < StateVersion; v++ {
+		if err := stateMigrations[v](state); err != nil {
+			return version, fmt.Errorf("failed to migrate state from version %d to %d: %w", v, v+1, err)
+		}
+		state["version"] = v + 1
+	}
+	state["version"] = StateVersion
+	return version, nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateMigrations(t *testing.T) {
+	if len(stateMigrations) != StateVersion {
+		t.Fatalf("got %d migrations for state version %d", len(stateMigrations), StateVersion)
+	}
+}
+
+func TestLoadStateMigratesUnversionedFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.yaml")
+	original := "goals:\n- id: a\n  score: 5\n"
+	if err := ioutil.WriteFile(filename, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := LoadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Version != StateVersion || len(state.Goals) != 1 || state.Goals[0].Score != 5 {
+		t.Errorf("got %+v", state)
+	}
+	if got := readFile(t, filename+".v0"); got != original {
+		t.Errorf("backup: got %q; want %q", got, original)
+	}
+
+	state, err = LoadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Version != StateVersion {
+		t.Errorf("got version %d after migration; want %d", state.Version, StateVersion)
+	}
+}
+
+func TestLoadStateRefusesNewerVersion(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.yaml")
+	if err := ioutil.WriteFile(filename, []byte("version: 1000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState(filename); !errors.Is(err, ErrNewerStateVersion) {
+		t.Errorf("got %v; want ErrNewerStateVersion", err)
+	}
+}
@@ -1,52 +1,439 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/dmage/gypd/api"
 	"sigs.k8s.io/yaml"
 )
 
+const (
+	// stateBackups is the number of previous versions of the state file
+	// that are kept as state.yaml.1, state.yaml.2, etc.
+	stateBackups = 3
+)
+
 type Goal struct {
-	ID    string `json:"id"`
-	Score int    `json:"score"`
+	ID            string     `json:"id"`
+	Score         int        `json:"score"`
+	Archived      bool       `json:"archived,omitempty"`
+	Description   string     `json:"description,omitempty"`
+	Owner         string     `json:"owner,omitempty"`
+	Deadline      *time.Time `json:"deadline,omitempty"`
+	TargetVersion string     `json:"target_version,omitempty"`
+	Links         []string   `json:"links,omitempty"`
+	CreatedBy     string     `json:"created_by,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+
+	// TemplateID is set for goals created from a recurring template.
+	TemplateID string `json:"template_id,omitempty"`
 }
 
 type Marker struct {
-	Name  string     `json:"name"`
-	Until *time.Time `json:"until,omitempty"`
+	Name      string     `json:"name"`
+	Until     *time.Time `json:"until,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	Author    string     `json:"author,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// RemovedBy and RemovedAt are set for markers in the history.
+	RemovedBy string     `json:"removed_by,omitempty"`
+	RemovedAt *time.Time `json:"removed_at,omitempty"`
+}
+
+type RelationType string
+
+const (
+	RelationParent     RelationType = "parent"
+	RelationBlocks     RelationType = "blocks"
+	RelationRelatesTo  RelationType = "relates-to"
+	RelationDuplicates RelationType = "duplicates"
+)
+
+func (t RelationType) Valid() bool {
+	switch t {
+	case RelationParent, RelationBlocks, RelationRelatesTo, RelationDuplicates:
+		return true
+	}
+	return false
+}
+
+// Relation links a task to another task.
+type Relation struct {
+	Type   RelationType `json:"type"`
+	TaskID string       `json:"task_id"`
+}
+
+// Pin overrides the position of a task in the ranked list.
+type Pin struct {
+	// Top moves the task to the top of the list.
+	Top bool `json:"top,omitempty"`
+
+	// Position moves the task to the given 1-based position.
+	Position int `json:"position,omitempty"`
+
+	// Below keeps the task below the given tasks.
+	Below []string `json:"below,omitempty"`
 }
 
 type TaskState struct {
-	ID       string   `json:"id"`
-	ParentID string   `json:"parent_id,omitempty"`
-	Markers  []Marker `json:"markers,omitempty"`
+	ID        string     `json:"id"`
+	ParentID  string     `json:"parent_id,omitempty"`
+	Markers   []Marker   `json:"markers,omitempty"`
+	Relations []Relation `json:"relations,omitempty"`
+	UpdatedBy string     `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+
+	// Labels are added to the labels of the task.
+	Labels api.Labels `json:"labels,omitempty"`
+
+	Pin *Pin `json:"pin,omitempty"`
+
+	// Notes are private Markdown notes. They are never sent to the trackers.
+	Notes string `json:"notes,omitempty"`
+
+	// MarkerHistory contains markers that were removed or replaced.
+	MarkerHistory []Marker `json:"marker_history,omitempty"`
+
+	// LastSeen is when the task was last returned by a task source.
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+
+	// DoneAt is when the task was first seen done, and DoneUnder are its
+	// ancestors at that moment.
+	DoneAt    *time.Time `json:"done_at,omitempty"`
+	DoneUnder []string   `json:"done_under,omitempty"`
+}
+
+// LocalTask is a task that exists only in gypd.
+type LocalTask struct {
+	ID          string       `json:"id"`
+	Summary     string       `json:"summary"`
+	Status      api.Status   `json:"status"`
+	Assignee    string       `json:"assignee,omitempty"`
+	Priority    api.Priority `json:"priority,omitempty"`
+	Labels      api.Labels   `json:"labels,omitempty"`
+	CreatedBy   string       `json:"created_by,omitempty"`
+	CreatedAt   *time.Time   `json:"created_at,omitempty"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+
+	// TemplateID is set for tasks created from a recurring template. Such
+	// tasks are deleted at ExpiresAt if they aren't done.
+	TemplateID string     `json:"template_id,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+const (
+	TemplateKindTask = "task"
+	TemplateKindGoal = "goal"
+)
+
+// Template describes a local task or a goal that is created on schedule.
+type Template struct {
+	ID string `json:"id"`
+
+	// Kind is either "task" (the default) or "goal".
+	Kind string `json:"kind,omitempty"`
+
+	// Schedule is a cron expression, see calendar.ParseSchedule. It is
+	// evaluated in the team's timezone.
+	Schedule string       `json:"schedule"`
+	Summary  string       `json:"summary"`
+	Assignee string       `json:"assignee,omitempty"`
+	Priority api.Priority `json:"priority,omitempty"`
+	Labels   api.Labels   `json:"labels,omitempty"`
+	Score    int          `json:"score,omitempty"`
+	ParentID string       `json:"parent_id,omitempty"`
+
+	// ExpireAfter is how long an instance lives. Tasks that aren't done by
+	// then are deleted, goals are archived.
+	ExpireAfter *Duration `json:"expire_after,omitempty"`
+
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// LastRun is the scheduled time of the last created instance.
+	LastRun *time.Time `json:"last_run,omitempty"`
+}
+
+type PlanItem struct {
+	TaskID string `json:"task_id"`
+	Done   bool   `json:"done,omitempty"`
+}
+
+// Plan is the ordered list of tasks that a team member plans to work on
+// during a day.
+type Plan struct {
+	Member    string     `json:"member"`
+	Date      string     `json:"date"`
+	Items     []PlanItem `json:"items"`
+	UpdatedBy string     `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// Key identifies the plan in the state.
+func (p Plan) Key() string {
+	return p.Member + "/" + p.Date
 }
 
 type State struct {
-	Goals []Goal      `json:"goals,omitempty"`
-	Tasks []TaskState `json:"tasks,omitempty"`
+	Version    int         `json:"version"`
+	Goals      []Goal      `json:"goals,omitempty"`
+	Tasks      []TaskState `json:"tasks,omitempty"`
+	LocalTasks []LocalTask `json:"local_tasks,omitempty"`
+	Templates  []Template  `json:"templates,omitempty"`
+	Plans      []Plan      `json:"plans,omitempty"`
+
+	// LastLocalTaskID is the highest ID given to a local task, so that the
+	// IDs of deleted tasks are not reused.
+	LastLocalTaskID int `json:"last_local_task_id,omitempty"`
 }
 
-func LoadState() (*State, error) {
+// DecodeRawState converts the raw state produced by MigrateState into State.
+func DecodeRawState(raw map[string]interface{}) (*State, error) {
+	buf, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
 	var state State
-	buf, err := ioutil.ReadFile("./state.yaml")
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// LoadState reads the state file. Files with an older schema are migrated,
+// and the original file is kept as filename.vN, where N is its version.
+func LoadState(filename string) (*State, error) {
+	buf, err := ioutil.ReadFile(filename)
 	if os.IsNotExist(err) {
-		return &state, nil
+		return &State{Version: StateVersion}, nil
 	} else if err != nil {
 		return nil, err
 	}
-	if err := yaml.Unmarshal(buf, &state); err != nil {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(buf, &raw); err != nil {
 		return nil, err
 	}
-	return &state, nil
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+	version, err := MigrateState(raw)
+	if err != nil {
+		return nil, err
+	}
+	state, err := DecodeRawState(raw)
+	if err != nil {
+		return nil, err
+	}
+	if version != StateVersion {
+		if err := copyFile(filename, fmt.Sprintf("%s.v%d", filename, version)); err != nil {
+			return nil, fmt.Errorf("failed to back up state before migration: %w", err)
+		}
+		if err := SaveState(filename, state); err != nil {
+			return nil, fmt.Errorf("failed to save migrated state: %w", err)
+		}
+	}
+	return state, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// rotateBackups shifts the backups of filename and saves its current
+// content as filename.1. The file itself is left in place.
+func rotateBackups(filename string, n int) error {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for i := n - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", filename, i), fmt.Sprintf("%s.%d", filename, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	backup := filename + ".1"
+	if err := os.Remove(backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(filename, backup); err == nil {
+		return nil
+	}
+	return copyFile(filename, backup)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to
+// filename, so that readers see either the old or the new content.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(filename)
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return err
+	}
+	return syncDir(dir)
 }
 
-func SaveState(state *State) error {
-	buf, err := yaml.Marshal(state)
+func SaveState(filename string, state *State) error {
+	versioned := *state
+	versioned.Version = StateVersion
+	buf, err := yaml.Marshal(&versioned)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile("./state.yaml", buf, 0644)
+	if err := rotateBackups(filename, stateBackups); err != nil {
+		return fmt.Errorf("failed to back up state: %w", err)
+	}
+	return writeFileAtomic(filename, buf, 0644)
+}
+
+// ArchiveEntry is a piece of state that was removed by the garbage collector.
+type ArchiveEntry struct {
+	ArchivedAt time.Time  `json:"archived_at"`
+	TaskID     string     `json:"task_id"`
+	Marker     *Marker    `json:"marker,omitempty"`
+	TaskState  *TaskState `json:"task_state,omitempty"`
+}
+
+// AppendArchive appends entries to the archive file, one JSON object per
+// line.
+func AppendArchive(filename string, entries []ArchiveEntry) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// JournalChange is a change of a single goal or task state. A nil before
+// value means that the object was created, a nil after value means that it
+// was deleted.
+type JournalChange struct {
+	GoalID          string     `json:"goal_id,omitempty"`
+	GoalBefore      *Goal      `json:"goal_before,omitempty"`
+	GoalAfter       *Goal      `json:"goal_after,omitempty"`
+	TaskID          string     `json:"task_id,omitempty"`
+	TaskBefore      *TaskState `json:"task_before,omitempty"`
+	TaskAfter       *TaskState `json:"task_after,omitempty"`
+	LocalTaskID     string     `json:"local_task_id,omitempty"`
+	LocalTaskBefore *LocalTask `json:"local_task_before,omitempty"`
+	LocalTaskAfter  *LocalTask `json:"local_task_after,omitempty"`
+	TemplateID      string     `json:"template_id,omitempty"`
+	TemplateBefore  *Template  `json:"template_before,omitempty"`
+	TemplateAfter   *Template  `json:"template_after,omitempty"`
+	PlanKey         string     `json:"plan_key,omitempty"`
+	PlanBefore      *Plan      `json:"plan_before,omitempty"`
+	PlanAfter       *Plan      `json:"plan_after,omitempty"`
+}
+
+// JournalEntry is a state operation recorded in the journal.
+type JournalEntry struct {
+	ID        int             `json:"id"`
+	Time      time.Time       `json:"time"`
+	User      string          `json:"user,omitempty"`
+	Operation string          `json:"operation"`
+	Undoes    int             `json:"undoes,omitempty"`
+	Changes   []JournalChange `json:"changes"`
+}
+
+// AppendJournal appends the entry to the journal file.
+func AppendJournal(filename string, entry JournalEntry) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(entry); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadJournal reads all entries from the journal file.
+func LoadJournal(filename string) ([]JournalEntry, error) {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	dec := json.NewDecoder(f)
+	for {
+		var entry JournalEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read journal entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func readFile(t *testing.T, filename string) string {
+	t.Helper()
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func TestWriteFileAtomicWithBackups(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state.yaml")
+
+	for i := 1; i <= 5; i++ {
+		if err := rotateBackups(filename, 3); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFileAtomic(filename, []byte(fmt.Sprintf("v%d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{
+		filename:        "v5",
+		filename + ".1": "v4",
+		filename + ".2": "v3",
+		filename + ".3": "v2",
+	}
+	for name, content := range expected {
+		if got := readFile(t, name); got != content {
+			t.Errorf("%s: got %q; want %q", filepath.Base(name), got, content)
+		}
+	}
+
+	matches, err := filepath.Glob(filename + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != len(expected) {
+		t.Errorf("got files %v; want %d files", matches, len(expected))
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+type compactionReports struct {
+	mu   sync.Mutex
+	last *statemanager.CompactionReport
+}
+
+func (c *compactionReports) set(report *statemanager.CompactionReport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = report
+}
+
+func (c *compactionReports) get() *statemanager.CompactionReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+func (s *Server) compact(dryRun bool) (*statemanager.CompactionReport, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	// Tasks that nobody has looked at recently must not be mistaken for
+	// vanished ones. The observation is saved only if it's not a dry run.
+	obs, err := s.observe(cfg)
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.stateManager.Compact(cfg.GC, time.Now(), &obs, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		s.compactionReports.set(report)
+		logrus.Infof("Garbage collection archived %d expired markers and %d task states.", len(report.ExpiredMarkers), len(report.RemovedTasks))
+	}
+	return report, nil
+}
+
+// runGC periodically compacts the state.
+func (s *Server) runGC(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := s.compact(false); err != nil {
+			logrus.Errorf("Failed to compact state: %v", err)
+		}
+	}
+}
+
+// GetGC returns the report of the last garbage collection.
+func (s *Server) GetGC(w http.ResponseWriter, r *http.Request) {
+	report := s.compactionReports.get()
+	if report == nil {
+		http.Error(w, "Garbage collection hasn't run yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// PostGC runs the garbage collection. With ?dryRun=true the state is not
+// modified.
+func (s *Server) PostGC(w http.ResponseWriter, r *http.Request) {
+	report, err := s.compact(r.URL.Query().Get("dryRun") == "true")
+	if err != nil {
+		logrus.Errorf("Failed to compact state: %v", err)
+		http.Error(w, "Failed to compact state", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dmage/gypd/auth"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *Server) GetGoals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.stateManager.GetGoals())
+}
+
+func (s *Server) GetGoal(w http.ResponseWriter, r *http.Request) {
+	goal, ok := s.stateManager.GetGoal(s.urlParam(r, "id"))
+	if !ok {
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goal)
+}
+
+// validateTeamMember checks that id is empty or refers to a known team
+// member.
+func validateTeamMember(id string) error {
+	if id == "" {
+		return nil
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	for _, member := range cfg.Team {
+		if member.ID == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown team member %q", id)
+}
+
+// validateGoal checks that the goal refers to known team members.
+func validateGoal(goal config.Goal) error {
+	if err := validateTeamMember(goal.Owner); err != nil {
+		return fmt.Errorf("invalid owner: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) PostGoal(w http.ResponseWriter, r *http.Request) {
+	var goal config.Goal
+	if err := json.NewDecoder(r.Body).Decode(&goal); err != nil {
+		logrus.Errorf("Failed to decode goal: %v", err)
+		http.Error(w, "Failed to decode goal", http.StatusBadRequest)
+		return
+	}
+	if goal.ID == "" {
+		http.Error(w, "missing goal id", http.StatusBadRequest)
+		return
+	}
+	if err := validateGoal(goal); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ok, err := s.stateManager.AddGoal(auth.User(r.Context()), goal)
+	if err != nil {
+		logrus.Errorf("Failed to save goal: %v", err)
+		http.Error(w, "Failed to save goal", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Goal already exists", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) updateGoal(w http.ResponseWriter, r *http.Request, id string, goal config.Goal) {
+	if goal.ID == "" {
+		http.Error(w, "missing goal id", http.StatusBadRequest)
+		return
+	}
+	if err := validateGoal(goal); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := s.stateManager.UpdateGoal(auth.User(r.Context()), id, goal)
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, statemanager.ErrAlreadyExists) {
+		http.Error(w, "Goal already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to save goal: %v", err)
+		http.Error(w, "Failed to save goal", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) PutGoal(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	goal := config.Goal{ID: id}
+	if err := json.NewDecoder(r.Body).Decode(&goal); err != nil {
+		logrus.Errorf("Failed to decode goal: %v", err)
+		http.Error(w, "Failed to decode goal", http.StatusBadRequest)
+		return
+	}
+	s.updateGoal(w, r, id, goal)
+}
+
+func (s *Server) PatchGoal(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	goal, ok := s.stateManager.GetGoal(id)
+	if !ok {
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+	var patch struct {
+		ID            *string         `json:"id"`
+		Score         *int            `json:"score"`
+		Archived      *bool           `json:"archived"`
+		Description   *string         `json:"description"`
+		Owner         *string         `json:"owner"`
+		Deadline      json.RawMessage `json:"deadline"`
+		TargetVersion *string         `json:"target_version"`
+		Links         *[]string       `json:"links"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		logrus.Errorf("Failed to decode goal: %v", err)
+		http.Error(w, "Failed to decode goal", http.StatusBadRequest)
+		return
+	}
+	if patch.ID != nil {
+		goal.ID = *patch.ID
+	}
+	if patch.Score != nil {
+		goal.Score = *patch.Score
+	}
+	if patch.Archived != nil {
+		goal.Archived = *patch.Archived
+	}
+	if patch.Description != nil {
+		goal.Description = *patch.Description
+	}
+	if patch.Owner != nil {
+		goal.Owner = *patch.Owner
+	}
+	if patch.Deadline != nil {
+		// "deadline": null clears the deadline.
+		goal.Deadline = nil
+		if err := json.Unmarshal(patch.Deadline, &goal.Deadline); err != nil {
+			http.Error(w, "invalid deadline", http.StatusBadRequest)
+			return
+		}
+	}
+	if patch.TargetVersion != nil {
+		goal.TargetVersion = *patch.TargetVersion
+	}
+	if patch.Links != nil {
+		goal.Links = *patch.Links
+	}
+	s.updateGoal(w, r, id, goal)
+}
+
+// DeleteGoal deletes the goal and detaches its children, unless the
+// reassignTo query parameter names a goal that should adopt them.
+func (s *Server) DeleteGoal(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	reassignTo := r.URL.Query().Get("reassignTo")
+	err := s.stateManager.DeleteGoal(auth.User(r.Context()), id, reassignTo)
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to delete goal: %v", err)
+		http.Error(w, "Failed to delete goal", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) GetGoalProgress(w http.ResponseWriter, r *http.Request) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logrus.Errorf("Failed to load config: %v", err)
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+	viewer, err := s.viewer(r, cfg.Team)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	_, rollup, err := s.getTasks(cfg, viewer)
+	if err != nil {
+		logrus.Errorf("Failed to get tasks: %v", err)
+		http.Error(w, "Failed to get tasks", http.StatusInternalServerError)
+		return
+	}
+	p, ok := rollup[fmt.Sprintf("goal:%s", s.urlParam(r, "id"))]
+	if !ok {
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
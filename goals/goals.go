@@ -2,6 +2,7 @@ package goals
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/dmage/gypd/api"
 	"github.com/dmage/gypd/config"
@@ -19,13 +20,35 @@ func NewTaskSource(stateManager *statemanager.StateManager) *TaskSource {
 func (ts *TaskSource) LoadTasks(cfg *config.Config) ([]*api.Task, error) {
 	var tasks []*api.Task
 	for _, goal := range ts.stateManager.GetGoals() {
-		tasks = append(tasks, &api.Task{
+		if goal.Archived {
+			continue
+		}
+		summary := goal.ID
+		if goal.Description != "" {
+			summary += ": " + strings.SplitN(goal.Description, "\n", 2)[0]
+		}
+		task := &api.Task{
 			ID:      fmt.Sprintf("goal:%s", goal.ID),
-			Summary: goal.ID,
+			Summary: summary,
+			Score:   goal.Score,
+			Created: goal.CreatedAt,
 			Labels: api.Labels{
 				{Key: "_source", Value: "goal"},
 			},
-		})
+		}
+		if len(goal.Links) > 0 {
+			task.URL = goal.Links[0]
+		}
+		if goal.Owner != "" {
+			task.Labels.Add("assignee", goal.Owner)
+		}
+		if goal.TargetVersion != "" {
+			task.Labels.Add("version", goal.TargetVersion)
+		}
+		if goal.Deadline != nil {
+			task.Labels.Add("due", goal.Deadline.Format("2006-01-02"))
+		}
+		tasks = append(tasks, task)
 	}
 	return tasks, nil
 }
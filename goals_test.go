@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/goals"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPatchGoal(t *testing.T) {
+	s := newTestServer(t, "")
+	deadline := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := s.stateManager.AddGoal("alice", config.Goal{ID: "g", Score: 10, Deadline: &deadline}); err != nil {
+		t.Fatal(err)
+	}
+	r := chi.NewRouter()
+	r.Patch("/api/goals/{id}", s.PatchGoal)
+
+	patch := func(body string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("PATCH", "/api/goals/g", strings.NewReader(body)))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s: got status %d: %s", body, w.Code, w.Body)
+		}
+	}
+
+	patch(`{"description": "Ship it"}`)
+	if goal, _ := s.stateManager.GetGoal("g"); goal.Deadline == nil || !goal.Deadline.Equal(deadline) || goal.Score != 10 {
+		t.Errorf("got goal %+v; want the deadline and the score kept", goal)
+	}
+
+	patch(`{"deadline": null}`)
+	if goal, _ := s.stateManager.GetGoal("g"); goal.Deadline != nil {
+		t.Errorf("got deadline %v; want none", goal.Deadline)
+	}
+	if !deadline.Equal(time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("the patch modified the previous deadline")
+	}
+}
+
+func TestGoalTasks(t *testing.T) {
+	s := newTestServer(t, "")
+	if _, err := s.stateManager.AddGoal("alice", config.Goal{ID: "g", Score: 10, Description: "Ship it\n\nDetails."}); err != nil {
+		t.Fatal(err)
+	}
+	s.taskSource = goals.NewTaskSource(s.stateManager)
+	cfg := &config.Config{}
+
+	tasks, _, err := s.getTasks(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Summary != "g: Ship it" || tasks[0].Score != 10 {
+		t.Errorf("got tasks %+v", tasks)
+	}
+}
@@ -39,6 +39,15 @@ function addMarker(task, marker, until) {
     .then(() => reload());
 }
 
+function removeMarker(task, marker) {
+  console.log("Removing marker " + marker + " from " + task.id);
+  return fetch('/api/tasks/' + encodeURIComponent(task.id) + '/markers/' + encodeURIComponent(marker), {
+    method: 'DELETE',
+  })
+    .then(handleErrors)
+    .then(() => reload());
+}
+
 function createGoal(id) {
   console.log("Creating goal " + id);
   return fetch('/api/goals', {
@@ -55,6 +64,31 @@ function createGoal(id) {
     .then(() => reload());
 }
 
+function createLocalTask(summary) {
+  console.log("Creating local task " + summary);
+  return fetch('/api/local-tasks', {
+    method: 'POST',
+    headers: {
+      'Accept': 'application/json',
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify({
+      summary: summary,
+    }),
+  })
+    .then(handleErrors)
+    .then(() => reload());
+}
+
+function completeLocalTask(task, reload) {
+  console.log("Completing " + task.id);
+  return fetch('/api/local-tasks/' + encodeURIComponent(task.id.substring('local:'.length)) + '/complete', {
+    method: 'POST',
+  })
+    .then(handleErrors)
+    .then(() => reload());
+}
+
 function setTaskParent(a, parentID, reload) {
   console.log("Setting parent of " + a.id + " to " + parentID);
   return fetch('/api/tasks/' + encodeURIComponent(a.id) + '/parent', {
@@ -71,6 +105,88 @@ function setTaskParent(a, parentID, reload) {
     .then(() => reload());
 }
 
+function removeTaskParent(a, parentID, reload) {
+  console.log("Removing parent " + parentID + " from " + a.id);
+  return fetch('/api/tasks/' + encodeURIComponent(a.id) + '/parent?id=' + encodeURIComponent(parentID), {
+    method: 'DELETE',
+  })
+    .then(handleErrors)
+    .then(() => reload());
+}
+
+function addLabel(task, reload) {
+  const label = window.prompt("Label for " + task.id + " (key: value)");
+  if (!label) {
+    return Promise.resolve();
+  }
+  const idx = label.indexOf(':');
+  if (idx === -1) {
+    return Promise.reject(Error("The label must have the form key: value"));
+  }
+  return fetch('/api/tasks/' + encodeURIComponent(task.id) + '/labels', {
+    method: 'POST',
+    headers: {
+      'Accept': 'application/json',
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify({
+      key: label.substring(0, idx).trim(),
+      value: label.substring(idx + 1).trim(),
+    }),
+  })
+    .then(handleErrors)
+    .then(() => reload());
+}
+
+function removeLabel(task, label, reload) {
+  return fetch('/api/tasks/' + encodeURIComponent(task.id) + '/labels/' + encodeURIComponent(label.key) + '/' + encodeURIComponent(label.value), {
+    method: 'DELETE',
+  })
+    .then(handleErrors)
+    .then(() => reload());
+}
+
+function setPin(task, pin, reload) {
+  console.log("Pinning " + task.id);
+  return fetch('/api/tasks/' + encodeURIComponent(task.id) + '/pin', {
+    method: pin ? 'PUT' : 'DELETE',
+    headers: {
+      'Accept': 'application/json',
+      'Content-Type': 'application/json',
+    },
+    body: pin ? JSON.stringify(pin) : undefined,
+  })
+    .then(handleErrors)
+    .then(() => reload());
+}
+
+function editNotes(task, reload) {
+  return fetch('/api/tasks/' + encodeURIComponent(task.id) + '/notes', {
+    headers: {
+      'Accept': 'application/json',
+    },
+  })
+    .then(handleErrors)
+    .then(response => response.json())
+    .then(data => {
+      const notes = window.prompt("Notes for " + task.id, data.notes);
+      if (notes === null) {
+        return;
+      }
+      return fetch('/api/tasks/' + encodeURIComponent(task.id) + '/notes', {
+        method: 'PUT',
+        headers: {
+          'Accept': 'application/json',
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({
+          notes: notes,
+        }),
+      })
+        .then(handleErrors)
+        .then(() => reload());
+    });
+}
 
 function keyValues(task, key) {
   return task.labels.reduce((result, label) => {
@@ -82,15 +198,56 @@ function keyValues(task, key) {
   }, []);
 }
 
+function labelTitle(task, label) {
+  if (label.startsWith('pin: ')) {
+    return pinTitle(task);
+  }
+  const prefix = 'marker: ';
+  if (!label.startsWith(prefix) || !task.markers) {
+    return undefined;
+  }
+  const marker = task.markers.find(m => m.name === label.substring(prefix.length));
+  if (!marker) {
+    return undefined;
+  }
+  const parts = [];
+  if (marker.reason) {
+    parts.push(marker.reason);
+  }
+  if (marker.author) {
+    parts.push('by ' + marker.author);
+  }
+  if (marker.createdAt) {
+    parts.push('on ' + new Date(marker.createdAt).toLocaleString());
+  }
+  if (marker.until) {
+    parts.push('until ' + new Date(marker.until).toLocaleString());
+  }
+  return parts.join(', ');
+}
+
+function pinTitle(task) {
+  if (!task.pin) {
+    return undefined;
+  }
+  let title = 'rank ' + task.pin.rank + ', computed rank ' + task.pin.computedRank;
+  if (task.pin.conflict) {
+    title += ': ' + task.pin.conflict;
+  }
+  return title;
+}
+
 function labelVariant(label) {
   return {
     'assignee: NONE': 'info',
     'flag: blocked': 'dark',
     'flag: blocker': 'warning',
     'flag: delegated': 'dark',
+    'flag: duplicate': 'dark',
     'flag: needs-info': 'danger',
     'flag: needs-stories': 'danger',
     'flag: untriaged': 'danger',
+    'pin: top': 'primary',
     'priority: P1': 'warning',
     'priority: P2': 'info',
     'status: MODIFIED': 'warning',
@@ -159,8 +316,8 @@ function hideChildren(tasks) {
     task.subtasks = [];
   }
   for (let task of tasks) {
-    let p = keyValues(task, 'parent').join(', ');
-    if (p !== '' && Object.prototype.hasOwnProperty.call(m, p)) {
+    let p = keyValues(task, 'parent').find(p => Object.prototype.hasOwnProperty.call(m, p));
+    if (p !== undefined) {
       task.hidden = true;
       m[p].subtasks.push(task);
     }
@@ -202,29 +359,84 @@ function FormCreateGoal({ className, onClose }) {
   );
 }
 
-function TaskBody({ task, goals, reload }) {
+function FormCreateTask({ className, onClose }) {
+  return (
+    <Card className={className}>
+      <Card.Header>Create Task</Card.Header>
+      <Card.Body>
+        <form onSubmit={(e) => {
+          e.preventDefault();
+          createLocalTask(e.target.summary.value);
+          onClose();
+        }}>
+          <div className="form-group">
+            <label htmlFor="summary">Summary</label>
+            <input type="text" className="form-control" id="summary" placeholder="Summary" required />
+          </div>
+          <button type="submit" className="mt-2 btn btn-primary">Create</button>
+        </form>
+      </Card.Body>
+    </Card>
+  );
+}
+
+function markerTitle(markerType) {
+  const until = markerType.defaultUntil;
+  if (!until) {
+    return "Mark as " + markerType.name;
+  }
+  if (until.startsWith('+')) {
+    return "Mark as " + markerType.name + " for " + until.substring(1);
+  }
+  return "Mark as " + markerType.name + " until " + until;
+}
+
+function TaskBody({ task, goals, markerTypes, reload }) {
   return (
     <div className="task">
       <div>
         <Button variant={statusVariant(task)} size="sm" href={task.url} disabled={!task.url} className={!task.url ? "disabled" : ""} target="_blank">{task.id}</Button>
       </div>
       <div className="pb-1">
-        <span>{task.summary}</span><br />
+        <span>{task.summary}</span>
+        {task.hasNotes && <span className="notes" title={task.notesSnippet}>{' '}📝</span>}
+        <br />
         {task.labels.filter(flag => !flag.startsWith('_')).map(flag => (
-          <><Badge bg={labelVariant(flag)} key={flag}>{flag}</Badge>{' '}</>
+          <><Badge bg={labelVariant(flag)} key={flag} title={labelTitle(task, flag)}>{flag}</Badge>{' '}</>
         ))}
         <Dropdown as="span">
           <Dropdown.Toggle as={BadgeToggle} variant="secondary">
             ⋮
           </Dropdown.Toggle>
           <Dropdown.Menu>
-            <Dropdown.Item onClick={() => addMarker(task, "blocked", "+12h")}>Mark as blocked for 12h</Dropdown.Item>
+            {markerTypes.map(markerType => (
+              <Dropdown.Item onClick={() => addMarker(task, markerType.name, markerType.defaultUntil)} title={markerType.description}>{markerTitle(markerType)}</Dropdown.Item>
+            ))}
             <Dropdown.Item onClick={() => addMarker(task, "important", "+168h")}>Mark as important for 7 days</Dropdown.Item>
             <Dropdown.Item onClick={() => addMarker(task, "later", "+12h")}>Mark as later for 12h</Dropdown.Item>
             <Dropdown.Item onClick={() => addMarker(task, "later", "+168h")}>Mark as later for 7 days</Dropdown.Item>
+            {(task.markers || []).map(marker => (
+              <Dropdown.Item onClick={() => removeMarker(task, marker.name)}>Remove marker {marker.name}</Dropdown.Item>
+            ))}
+            {task.labels.includes('_source: local') && !task.labels.includes('status: CLOSED') && (
+              <Dropdown.Item onClick={() => completeLocalTask(task, reload)}>Complete</Dropdown.Item>
+            )}
+            {task.pin ? (
+              <Dropdown.Item onClick={() => setPin(task, null, reload)}>Unpin</Dropdown.Item>
+            ) : (
+              <Dropdown.Item onClick={() => setPin(task, { top: true }, reload)}>Pin to the top</Dropdown.Item>
+            )}
+            <Dropdown.Item onClick={() => editNotes(task, reload)}>Edit notes</Dropdown.Item>
+            <Dropdown.Item onClick={() => addLabel(task, reload).catch(error => alert(error.message))}>Add label</Dropdown.Item>
+            {(task.localLabels || []).map(label => (
+              <Dropdown.Item onClick={() => removeLabel(task, label, reload)}>Remove label {label.key}: {label.value}</Dropdown.Item>
+            ))}
             <Dropdown.Divider />
-            {goals.map(goal => (
-              <Dropdown.Item onClick={() => setTaskParent(task, goal.id, reload)}>Add to the goal {goal.summary}</Dropdown.Item>
+            {goals.filter(goal => goal.id !== task.id).map(goal => (
+              <Dropdown.Item onClick={() => setTaskParent(task, goal.id, reload).catch(error => alert(error.message))}>Add to the goal {goal.summary}</Dropdown.Item>
+            ))}
+            {keyValues(task, 'parent').map(parentID => (
+              <Dropdown.Item onClick={() => removeTaskParent(task, parentID, reload).catch(error => alert(error.message))}>Remove from {parentID}</Dropdown.Item>
             ))}
           </Dropdown.Menu>
         </Dropdown>
@@ -233,15 +445,15 @@ function TaskBody({ task, goals, reload }) {
   );
 }
 
-function Task({ task, className, collapseTasks, goals, reload }) {
+function Task({ task, className, collapseTasks, goals, markerTypes, reload }) {
   return (
     <Card className={(className ? className + " " : "") + cardClassName(task)}>
       <Card.Body>
-        <TaskBody task={task} goals={goals} reload={reload}  />
+        <TaskBody task={task} goals={goals} markerTypes={markerTypes} reload={reload}  />
         {collapseTasks ? (
           task.subtasks.length === 0 ? null : <div>{task.subtasks.length} subtasks</div>
         ) : (
-          task.subtasks.map(t => <Task task={t} className="mb-1 ms-4" collapseTasks={collapseTasks} goals={goals} reload={reload} />)
+          task.subtasks.map(t => <Task task={t} className="mb-1 ms-4" collapseTasks={collapseTasks} goals={goals} markerTypes={markerTypes} reload={reload} />)
         )}
       </Card.Body>
     </Card>
@@ -253,13 +465,15 @@ function App() {
   const [tasks, setTasks] = useState(null);
   const [loading, setLoading] = useState(true);
   const [goals, setGoals] = useState(null);
+  const [markerTypes, setMarkerTypes] = useState([]);
   const [showAddGoal, setShowAddGoal] = useState(false);
+  const [showAddTask, setShowAddTask] = useState(false);
   const [collapseTasks, setCollapseTasks] = useState(false);
 
   const loadTasks = () => {
     setLoading(true);
     fetch(
-      '/api/tasks', {
+      '/api/tasks' + window.location.search, {
       headers: {
         'Accept': 'application/json',
       },
@@ -278,7 +492,21 @@ function App() {
       })
   }
 
+  const loadMarkerTypes = () => {
+    fetch(
+      '/api/marker-types', {
+      headers: {
+        'Accept': 'application/json',
+      },
+    })
+      .then(handleErrors)
+      .then(response => response.json())
+      .then(data => setMarkerTypes(data))
+      .catch(error => console.log("Failed to load marker types: " + error.message));
+  }
+
   useEffect(loadTasks, []);
+  useEffect(loadMarkerTypes, []);
 
   if (error) {
     return (
@@ -311,6 +539,13 @@ function App() {
           >
             Add Goal
           </Button>
+          <Button
+            className="mt-4 ms-1"
+            variant="outline-primary"
+            onClick={() => setShowAddTask(!showAddTask)}
+          >
+            Add Task
+          </Button>
           <Button
             className="mt-4 ms-1"
             variant="outline-primary"
@@ -324,10 +559,16 @@ function App() {
               onClose={() => setShowAddGoal(false)}
             />
           )}
+          {showAddTask && (
+            <FormCreateTask
+              className="mt-2"
+              onClose={() => setShowAddTask(false)}
+            />
+          )}
           {tasks.filter(t => !t.hidden).map(task => (
             <Row className="mt-3 mb-3" key={task.id}>
               <Col>
-                <Task task={task} collapseTasks={collapseTasks} goals={goals} reload={loadTasks} />
+                <Task task={task} collapseTasks={collapseTasks} goals={goals} markerTypes={markerTypes} reload={loadTasks} />
               </Col>
             </Row>
           ))}
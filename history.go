@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/dmage/gypd/auth"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+// GetHistory returns the journal of state changes, newest first. It can be
+// filtered by ?task= and limited by ?limit=.
+func (s *Server) GetHistory(w http.ResponseWriter, r *http.Request) {
+	limit, err := intParam(r, "limit")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := s.stateManager.History(r.URL.Query().Get("task"))
+	if err != nil {
+		logrus.Errorf("Failed to read history: %v", err)
+		http.Error(w, "Failed to read history", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []config.JournalEntry{}
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func (s *Server) PostHistoryUndo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(s.urlParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := s.stateManager.Undo(auth.User(r.Context()), id)
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "History entry not found", http.StatusNotFound)
+		return
+	} else if errors.Is(err, statemanager.ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to undo history entry %d: %v", id, err)
+		http.Error(w, "Failed to undo", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
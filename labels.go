@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/auth"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+// reservedLabelKeys are the label keys that are computed by gypd, have their
+// own endpoints, or come from the trackers and must have a single value.
+var reservedLabelKeys = map[string]bool{
+	"assignee":            true,
+	"blocked-by":          true,
+	"blocked-descendants": true,
+	"blocks":              true,
+	"duplicated-by":       true,
+	"duplicates":          true,
+	"forecast":            true,
+	"marker":              true,
+	"parent":              true,
+	"pin":                 true,
+	"priority":            true,
+	"progress":            true,
+	"relates-to":          true,
+	"score":               true,
+	"status":              true,
+}
+
+func validLabelKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "_") && !strings.Contains(key, ":") && !reservedLabelKeys[key]
+}
+
+func (s *Server) GetTaskLabels(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	taskState, _ := s.stateManager.GetTaskState(id)
+	labels := taskState.Labels
+	if labels == nil {
+		labels = api.Labels{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(labels)
+}
+
+func (s *Server) PostTaskLabel(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var label api.KeyValue
+	if err := json.NewDecoder(r.Body).Decode(&label); err != nil {
+		logrus.Errorf("Failed to decode label: %v", err)
+		http.Error(w, "Failed to decode label", http.StatusBadRequest)
+		return
+	}
+	if !validLabelKey(label.Key) {
+		http.Error(w, "invalid label key", http.StatusBadRequest)
+		return
+	}
+	if label.Value == "" {
+		http.Error(w, "missing label value", http.StatusBadRequest)
+		return
+	}
+
+	err := s.stateManager.AddTaskLabel(auth.User(r.Context()), id, label)
+	if err != nil {
+		logrus.Errorf("Failed to save label: %v", err)
+		http.Error(w, "Failed to save label", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) DeleteTaskLabel(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	label := api.KeyValue{
+		Key:   s.urlParam(r, "key"),
+		Value: s.urlParam(r, "value"),
+	}
+	if id == "" || label.Key == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	err := s.stateManager.RemoveTaskLabel(auth.User(r.Context()), id, label)
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "Label not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to remove label: %v", err)
+		http.Error(w, "Failed to remove label", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
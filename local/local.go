@@ -0,0 +1,56 @@
+package local
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+)
+
+// closedTaskRetention is how long closed tasks are still returned, so that
+// their completion is noticed by the progress rollup.
+const closedTaskRetention = 24 * time.Hour
+
+type TaskSource struct {
+	stateManager *statemanager.StateManager
+}
+
+func NewTaskSource(stateManager *statemanager.StateManager) *TaskSource {
+	return &TaskSource{stateManager: stateManager}
+}
+
+func (ts *TaskSource) LoadTasks(cfg *config.Config) ([]*api.Task, error) {
+	now := time.Now()
+	var tasks []*api.Task
+	for _, localTask := range ts.stateManager.GetLocalTasks() {
+		if localTask.Status == api.StatusClosed && localTask.CompletedAt != nil && now.Sub(*localTask.CompletedAt) > closedTaskRetention {
+			continue
+		}
+		assignee := localTask.Assignee
+		if assignee == "" {
+			assignee = api.AssigneeNone
+		}
+		task := &api.Task{
+			ID:       fmt.Sprintf("local:%s", localTask.ID),
+			Summary:  localTask.Summary,
+			Created:  localTask.CreatedAt,
+			Resolved: localTask.CompletedAt,
+			Labels: api.Labels{
+				{Key: "_source", Value: "local"},
+				{Key: "type", Value: "Task"},
+				{Key: "status", Value: localTask.Status.String()},
+				{Key: "assignee", Value: assignee},
+			},
+		}
+		if localTask.Priority != "" {
+			task.Labels.Add("priority", localTask.Priority.String())
+		}
+		for _, label := range localTask.Labels {
+			task.Labels.Add(label.Key, label.Value)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
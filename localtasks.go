@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/auth"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+// localTaskLabelKeys are the label keys that are set from the fields of a
+// local task.
+var localTaskLabelKeys = map[string]bool{
+	"assignee": true,
+	"priority": true,
+	"status":   true,
+	"type":     true,
+}
+
+func validateLocalTask(task config.LocalTask) error {
+	if task.Summary == "" {
+		return fmt.Errorf("missing summary")
+	}
+	if !task.Status.Valid() {
+		return fmt.Errorf("invalid status %q", task.Status)
+	}
+	if task.Priority != "" && !task.Priority.Valid() {
+		return fmt.Errorf("invalid priority %q", task.Priority)
+	}
+	if err := validateTeamMember(task.Assignee); err != nil {
+		return fmt.Errorf("invalid assignee: %w", err)
+	}
+	for _, label := range task.Labels {
+		if !validLabelKey(label.Key) || localTaskLabelKeys[label.Key] || label.Value == "" {
+			return fmt.Errorf("invalid label %q", label.Key+": "+label.Value)
+		}
+	}
+	return nil
+}
+
+func (s *Server) GetLocalTasks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.stateManager.GetLocalTasks())
+}
+
+func (s *Server) GetLocalTask(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.stateManager.GetLocalTask(s.urlParam(r, "id"))
+	if !ok {
+		http.Error(w, "Local task not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+func (s *Server) PostLocalTask(w http.ResponseWriter, r *http.Request) {
+	var task config.LocalTask
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		logrus.Errorf("Failed to decode local task: %v", err)
+		http.Error(w, "Failed to decode local task", http.StatusBadRequest)
+		return
+	}
+	if task.Status == "" {
+		task.Status = api.StatusNew
+	}
+	if err := validateLocalTask(task); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task, err := s.stateManager.AddLocalTask(auth.User(r.Context()), task)
+	if err != nil {
+		logrus.Errorf("Failed to save local task: %v", err)
+		http.Error(w, "Failed to save local task", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(task)
+}
+
+func (s *Server) updateLocalTask(w http.ResponseWriter, r *http.Request, task config.LocalTask) {
+	if err := validateLocalTask(task); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err := s.stateManager.UpdateLocalTask(auth.User(r.Context()), task)
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "Local task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to save local task: %v", err)
+		http.Error(w, "Failed to save local task", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) PatchLocalTask(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.stateManager.GetLocalTask(s.urlParam(r, "id"))
+	if !ok {
+		http.Error(w, "Local task not found", http.StatusNotFound)
+		return
+	}
+	var patch struct {
+		Summary  *string       `json:"summary"`
+		Status   *api.Status   `json:"status"`
+		Assignee *string       `json:"assignee"`
+		Priority *api.Priority `json:"priority"`
+		Labels   *api.Labels   `json:"labels"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		logrus.Errorf("Failed to decode local task: %v", err)
+		http.Error(w, "Failed to decode local task", http.StatusBadRequest)
+		return
+	}
+	if patch.Summary != nil {
+		task.Summary = *patch.Summary
+	}
+	if patch.Status != nil {
+		task.Status = *patch.Status
+	}
+	if patch.Assignee != nil {
+		task.Assignee = *patch.Assignee
+	}
+	if patch.Priority != nil {
+		task.Priority = *patch.Priority
+	}
+	if patch.Labels != nil {
+		task.Labels = *patch.Labels
+	}
+	s.updateLocalTask(w, r, task)
+}
+
+// PostLocalTaskComplete closes the local task.
+func (s *Server) PostLocalTaskComplete(w http.ResponseWriter, r *http.Request) {
+	task, ok := s.stateManager.GetLocalTask(s.urlParam(r, "id"))
+	if !ok {
+		http.Error(w, "Local task not found", http.StatusNotFound)
+		return
+	}
+	task.Status = api.StatusClosed
+	s.updateLocalTask(w, r, task)
+}
+
+func (s *Server) DeleteLocalTask(w http.ResponseWriter, r *http.Request) {
+	err := s.stateManager.DeleteLocalTask(auth.User(r.Context()), s.urlParam(r, "id"))
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "Local task not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to delete local task: %v", err)
+		http.Error(w, "Failed to delete local task", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -3,23 +3,29 @@ package main
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
+	"math"
 	"net/http"
 	"net/url"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/auth"
 	"github.com/dmage/gypd/config"
 	"github.com/dmage/gypd/goals"
+	"github.com/dmage/gypd/local"
 	"github.com/dmage/gypd/mathgraph"
+	"github.com/dmage/gypd/progress"
 	"github.com/dmage/gypd/rh"
 	"github.com/dmage/gypd/rhbz"
+	"github.com/dmage/gypd/selector"
 	"github.com/dmage/gypd/statemanager"
+	"github.com/dmage/gypd/statestore"
 	"github.com/dmage/gypd/tasksource"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -30,11 +36,47 @@ import (
 var frontend embed.FS
 
 var (
-	addr = flag.String("addr", ":8080", "http service address")
+	addr    = flag.String("addr", ":8080", "http service address")
+	state   = flag.String("state", "yaml:./state.yaml", "state store (yaml:FILE or bolt:FILE)")
+	journal = flag.String("journal", "./state-journal.jsonl", "journal of state changes (empty to disable)")
 )
 
+// addRelation adds labels for a local relation to the task and, if it's
+// known, to the related task.
+func addRelation(byID map[string]*api.Task, task *api.Task, relation config.Relation) {
+	other := byID[relation.TaskID]
+	switch relation.Type {
+	case config.RelationParent:
+		task.Labels.Add("parent", relation.TaskID)
+	case config.RelationBlocks:
+		if other != nil {
+			status := task.Labels.Get("status")
+			if len(status) == 1 && api.Status(status[0]).Done() {
+				return
+			}
+			other.Labels.Add("blocked-by", task.ID)
+		}
+		task.Labels.Add("blocks", relation.TaskID)
+	case config.RelationRelatesTo:
+		task.Labels.Add("relates-to", relation.TaskID)
+		if other != nil {
+			other.Labels.Add("relates-to", task.ID)
+		}
+	case config.RelationDuplicates:
+		task.Labels.Add("duplicates", relation.TaskID)
+		task.Labels.Add("flag", "duplicate")
+		if other != nil {
+			other.Labels.Add("duplicated-by", task.ID)
+		}
+	}
+}
+
 func updateMarkers(tasks []*api.Task, sm *statemanager.StateManager) {
 	now := time.Now()
+	byID := make(map[string]*api.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
 	for _, task := range tasks {
 		taskState, ok := sm.GetTaskState(task.ID)
 		if !ok {
@@ -45,40 +87,96 @@ func updateMarkers(tasks []*api.Task, sm *statemanager.StateManager) {
 			task.Labels.Add("parent", taskState.ParentID)
 		}
 
+		for _, label := range taskState.Labels {
+			// Labels stored before their keys were reserved are ignored.
+			if !validLabelKey(label.Key) {
+				continue
+			}
+			task.Labels.Add(label.Key, label.Value)
+			task.LocalLabels = append(task.LocalLabels, label)
+		}
+
+		if taskState.Pin != nil {
+			task.Pin = &api.Pin{
+				Top:      taskState.Pin.Top,
+				Position: taskState.Pin.Position,
+				Below:    taskState.Pin.Below,
+			}
+			for _, value := range pinLabels(taskState.Pin) {
+				task.Labels.Add("pin", value)
+			}
+		}
+
+		if taskState.Notes != "" {
+			task.HasNotes = true
+			task.NotesSnippet = notesSnippet(taskState.Notes)
+		}
+
+		for _, relation := range taskState.Relations {
+			addRelation(byID, task, relation)
+		}
+
 		for _, marker := range taskState.Markers {
 			if marker.Until == nil || marker.Until.After(now) {
 				task.Labels.Add("marker", marker.Name)
+				task.Markers = append(task.Markers, apiMarker(marker))
 			}
 		}
 	}
 }
 
-func reconsileTask(task *api.Task, team []config.TeamMember, scoreRules []config.ScoreRule) {
-	assignee := task.Labels.Get("assignee")
-	if len(assignee) == 1 && assignee[0] != api.AssigneeNone && assignee[0] != team[0].ID {
-		task.Labels.Add("flag", "delegated")
+func reconsileTask(task *api.Task, viewer string, cfg *config.Config) {
+	if viewer != "" {
+		assignee := task.Labels.Get("assignee")
+		if len(assignee) == 1 && assignee[0] != api.AssigneeNone && assignee[0] != viewer {
+			task.Labels.Add("flag", "delegated")
+		}
+
+		if task.Labels.Has("needinfo-on", viewer) {
+			task.Labels.Add("flag", "needs-info")
+		}
 	}
 
 	if len(task.Labels.Get("blocked-by")) > 0 {
 		task.Labels.Add("flag", "blocked")
 	}
 
-	if task.Labels.Has("marker", "blocked") {
-		task.Labels.Add("flag", "blocked")
+	var markerTypes []config.MarkerType
+	for _, marker := range task.Labels.Get("marker") {
+		markerType, ok := cfg.GetMarkerType(marker)
+		if !ok {
+			continue
+		}
+		markerTypes = append(markerTypes, markerType)
+		if markerType.Flag != "" {
+			task.Labels.Add("flag", markerType.Flag)
+		}
+		if markerType.Hide {
+			task.Labels.Add("_hidden", "true")
+		}
 	}
 
-	score := 0
-	for _, rule := range scoreRules {
-		if rule.Match(task.Labels) {
+	// Task sources can set the base score, e.g. goals have their own score.
+	score := task.Score
+	for _, rule := range cfg.ScoreRules {
+		if rule.Match(task.Labels, viewer) {
 			score += rule.Score
 		}
 	}
+	for _, markerType := range markerTypes {
+		score += markerType.AddScore
+	}
+	for _, markerType := range markerTypes {
+		if markerType.MultiplyScore != 0 {
+			score = int(math.Round(float64(score) * markerType.MultiplyScore))
+		}
+	}
 	task.Score = score
 
 	task.Labels.Sort()
 }
 
-func updateTasks(tasks []*api.Task) []*api.Task {
+func updateTasks(tasks []*api.Task, keys []sortKey) []*api.Task {
 	score := map[string]*mathgraph.Sum{}
 	children := map[string]*mathgraph.Max{}
 	for _, task := range tasks {
@@ -100,9 +198,9 @@ func updateTasks(tasks []*api.Task) []*api.Task {
 		task.Labels.Add("score", strconv.Itoa(task.Score))
 	}
 
-	sort.Slice(tasks, func(i, j int) bool {
-		return tasks[i].Score > tasks[j].Score
-	})
+	// The ID comes last, so that the order doesn't change between requests.
+	keys = append(append([]sortKey{{name: "score"}}, keys...), sortKey{name: "id"})
+	sortTasks(tasks, keys)
 
 	return tasks
 }
@@ -110,6 +208,8 @@ func updateTasks(tasks []*api.Task) []*api.Task {
 type Server struct {
 	taskSource   tasksource.TaskSource
 	stateManager *statemanager.StateManager
+
+	compactionReports compactionReports
 }
 
 func (s *Server) urlParam(r *http.Request, name string) string {
@@ -123,138 +223,252 @@ func (s *Server) urlParam(r *http.Request, name string) string {
 	return value
 }
 
-func (s *Server) getTasks() ([]*api.Task, error) {
-	cfg, err := config.LoadConfig()
+// viewer returns the ID of the team member on whose behalf the request is
+// made. It defaults to the authenticated user if they are a team member, or
+// to the first team member otherwise.
+func (s *Server) viewer(r *http.Request, team []config.TeamMember) (string, error) {
+	id := r.URL.Query().Get("viewer")
+	if id == "" {
+		id = r.Header.Get("X-Gypd-Viewer")
+	}
+	if id == "" {
+		user := auth.User(r.Context())
+		for _, member := range team {
+			if member.ID == user {
+				return user, nil
+			}
+		}
+		if len(team) == 0 {
+			return "", nil
+		}
+		return team[0].ID, nil
+	}
+	for _, member := range team {
+		if member.ID == id {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("unknown viewer %q", id)
+}
+
+// updateProgress adds progress labels to goals and epics.
+func (s *Server) updateProgress(tasks []*api.Task) map[string]*progress.Progress {
+	result := progress.Compute(tasks, s.stateManager.GetCompletions(), time.Now())
+	for _, task := range tasks {
+		p, ok := result[task.ID]
+		if !ok || p.Total == 0 {
+			continue
+		}
+		task.Labels.Add("progress", fmt.Sprintf("%d%%", p.PercentDone))
+		if p.Blocked > 0 {
+			task.Labels.Add("blocked-descendants", strconv.Itoa(p.Blocked))
+		}
+		if p.Forecast != nil {
+			task.Labels.Add("forecast", p.Forecast.Format("2006-01-02"))
+		}
+		task.Labels.Sort()
+	}
+	return result
+}
+
+func (s *Server) getTasks(cfg *config.Config, viewer string) ([]*api.Task, map[string]*progress.Progress, error) {
+	keys, err := parseSortKeys(cfg.GetSort())
 	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %w", err)
+		return nil, nil, fmt.Errorf("invalid sort keys: %w", err)
 	}
 
 	tasks, err := s.taskSource.LoadTasks(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load tasks: %w", err)
+		return nil, nil, fmt.Errorf("failed to load tasks: %w", err)
 	}
 
 	updateMarkers(tasks, s.stateManager)
 	for i := range tasks {
-		reconsileTask(tasks[i], cfg.Team, cfg.ScoreRules)
+		reconsileTask(tasks[i], viewer, cfg)
 	}
-	tasks = updateTasks(tasks)
+	rollup := s.updateProgress(tasks)
+	tasks = updateTasks(tasks, keys)
 
-	return tasks, nil
+	return tasks, rollup, nil
 }
 
-func (s *Server) GetTasks(w http.ResponseWriter, r *http.Request) {
-	tasks, err := s.getTasks()
-	if err != nil {
-		logrus.Errorf("Failed to get tasks: %v", err)
-		http.Error(w, "Failed to get tasks", http.StatusInternalServerError)
-		return
+// intParam returns the non-negative integer query parameter, or 0 if it is not
+// set.
+func intParam(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tasks)
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return n, nil
 }
 
-func (s *Server) PostTaskMarker(w http.ResponseWriter, r *http.Request) {
-	id := s.urlParam(r, "id")
-	if id == "" {
-		http.Error(w, "missing id", http.StatusBadRequest)
+func (s *Server) GetTasks(w http.ResponseWriter, r *http.Request) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logrus.Errorf("Failed to load config: %v", err)
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
 		return
 	}
-	var params struct {
-		Marker string `json:"marker"`
-		Until  string `json:"until"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		logrus.Errorf("Failed to decode marker: %v", err)
-		http.Error(w, "Failed to decode marker", http.StatusBadRequest)
+	viewer, err := s.viewer(r, cfg.Team)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	markerName := params.Marker
-	if markerName == "" {
-		http.Error(w, "missing marker", http.StatusBadRequest)
+	tasks, _, err := s.getTasks(cfg, viewer)
+	if err != nil {
+		logrus.Errorf("Failed to get tasks: %v", err)
+		http.Error(w, "Failed to get tasks", http.StatusInternalServerError)
 		return
 	}
-	var until *time.Time
-	untilStr := params.Until
-	if untilStr != "" {
-		if strings.HasPrefix(untilStr, "+") && strings.HasSuffix(untilStr, "h") {
-			d, err := strconv.Atoi(untilStr[1 : len(untilStr)-1])
-			if err != nil {
-				http.Error(w, "invalid until", http.StatusBadRequest)
-				return
+	if r.URL.Query().Get("showHidden") != "true" {
+		visible := tasks[:0]
+		for _, task := range tasks {
+			if !task.Labels.Has("_hidden", "true") {
+				visible = append(visible, task)
 			}
-			untilTime := time.Now().Add(time.Duration(d) * time.Hour)
-			until = &untilTime
-		} else {
-			untilTime, err := time.Parse(time.RFC3339, untilStr)
-			if err != nil {
-				http.Error(w, "invalid until", http.StatusBadRequest)
-				return
+		}
+		tasks = visible
+	}
+	if search := r.URL.Query().Get("search"); search != "" {
+		found := tasks[:0]
+		for _, task := range tasks {
+			taskState, _ := s.stateManager.GetTaskState(task.ID)
+			if matchesSearch(search, task.Summary, taskState.Notes) {
+				found = append(found, task)
 			}
-			until = &untilTime
 		}
+		tasks = found
 	}
-
-	err := s.stateManager.AddTaskMarker(id, config.Marker{
-		Name:  markerName,
-		Until: until,
-	})
+	if query := r.URL.Query().Get("selector"); query != "" {
+		sel, err := selector.Parse(query)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid selector: %v", err), http.StatusBadRequest)
+			return
+		}
+		found := tasks[:0]
+		for _, task := range tasks {
+			if sel.Matches(task.Labels, viewer) {
+				found = append(found, task)
+			}
+		}
+		tasks = found
+	}
+	if order := r.URL.Query().Get("sort"); order != "" {
+		keys, err := parseSortKeys(strings.Split(order, ","))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sortTasks(tasks, keys)
+	}
+	// Pins are applied to the tasks that are returned, so that positions and
+	// ranks match what the client sees.
+	tasks = applyPins(tasks)
+	offset, err := intParam(r, "offset")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(r, "limit")
 	if err != nil {
-		logrus.Errorf("Failed to save marker: %v", err)
-		http.Error(w, "Failed to save marker", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(tasks)))
+	if offset > len(tasks) {
+		offset = len(tasks)
+	}
+	tasks = tasks[offset:]
+	if limit > 0 && limit < len(tasks) {
+		tasks = tasks[:limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
 }
 
-func (s *Server) PostTaskParent(w http.ResponseWriter, r *http.Request) {
+func (s *Server) PostTaskAction(w http.ResponseWriter, r *http.Request) {
 	id := s.urlParam(r, "id")
 	if id == "" {
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
 	var params struct {
-		ID string `json:"id"`
+		api.Action
+		DryRun bool `json:"dryRun"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		logrus.Errorf("Failed to decode request body: %v", err)
-		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		logrus.Errorf("Failed to decode action: %v", err)
+		http.Error(w, "Failed to decode action", http.StatusBadRequest)
 		return
 	}
-	if params.ID == "" {
-		http.Error(w, "missing parent id", http.StatusBadRequest)
+
+	writer, ok := s.taskSource.(tasksource.Writer)
+	if !ok {
+		http.Error(w, "Task sources are read-only", http.StatusNotImplemented)
 		return
 	}
 
-	err := s.stateManager.SetTaskParent(id, params.ID)
+	cfg, err := config.LoadConfig()
 	if err != nil {
-		logrus.Errorf("Failed to save parent: %v", err)
-		http.Error(w, "Failed to save parent", http.StatusInternalServerError)
+		logrus.Errorf("Failed to load config: %v", err)
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
-}
 
-func (s *Server) PostGoal(w http.ResponseWriter, r *http.Request) {
-	var goal config.Goal
-	if err := json.NewDecoder(r.Body).Decode(&goal); err != nil {
-		logrus.Errorf("Failed to decode goal: %v", err)
-		http.Error(w, "Failed to decode goal", http.StatusBadRequest)
+	description, err := writer.ApplyAction(cfg, id, params.Action, params.DryRun)
+	if errors.Is(err, tasksource.ErrUnknownTask) {
+		http.Error(w, "Task doesn't support actions", http.StatusNotFound)
 		return
-	}
-
-	ok, err := s.stateManager.AddGoal(goal)
-	if err != nil {
-		logrus.Errorf("Failed to save goal: %v", err)
-		http.Error(w, "Failed to save goal", http.StatusInternalServerError)
+	} else if errors.Is(err, tasksource.ErrInvalidAction) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
-	}
-	if !ok {
-		http.Error(w, "Goal already exists", http.StatusBadRequest)
+	} else if err != nil {
+		logrus.Errorf("Failed to apply action to %s: %v", id, err)
+		http.Error(w, "Failed to apply action", http.StatusBadGateway)
 		return
 	}
+	if !params.DryRun {
+		logrus.Infof("User %q: %s", auth.User(r.Context()), description)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Description string `json:"description"`
+		DryRun      bool   `json:"dryRun"`
+	}{
+		Description: description,
+		DryRun:      params.DryRun,
+	})
+}
 
-	w.WriteHeader(http.StatusCreated)
+func newAuthenticators(cfg config.AuthConfig) ([]auth.Authenticator, error) {
+	var authenticators []auth.Authenticator
+	if cfg.TokensFile != "" {
+		tokens, err := auth.LoadStaticTokens(cfg.TokensFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tokens: %w", err)
+		}
+		authenticators = append(authenticators, tokens)
+	}
+	if cfg.HtpasswdFile != "" {
+		htpasswd, err := auth.LoadHtpasswd(cfg.HtpasswdFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load htpasswd: %w", err)
+		}
+		authenticators = append(authenticators, htpasswd)
+	}
+	if cfg.OIDC != nil {
+		oidc, err := auth.NewOIDC(cfg.OIDC.Issuer, cfg.OIDC.ClientID, cfg.OIDC.UsernameClaim)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize OIDC: %w", err)
+		}
+		authenticators = append(authenticators, oidc)
+	}
+	return authenticators, nil
 }
 
 func main() {
@@ -262,7 +476,21 @@ func main() {
 	logrus.SetLevel(logrus.DebugLevel)
 	logrus.Debug("Starting.")
 
-	stateManager, err := statemanager.NewStateManager()
+	store, err := statestore.Open(*state)
+	if err != nil {
+		logrus.Fatalf("Failed to open state store: %v", err)
+	}
+	defer store.Close()
+
+	var stateJournal *statemanager.Journal
+	if *journal != "" {
+		stateJournal, err = statemanager.OpenJournal(*journal)
+		if err != nil {
+			logrus.Fatalf("Failed to open journal: %v", err)
+		}
+	}
+
+	stateManager, err := statemanager.NewStateManager(store, stateJournal)
 	if err != nil {
 		logrus.Fatalf("Failed to initialize state: %v", err)
 	}
@@ -271,20 +499,80 @@ func main() {
 		tasksource.NewCached(rhbz.NewTaskSource(), 2*time.Minute),
 		tasksource.NewCached(rh.NewTaskSource(), 5*time.Minute),
 		goals.NewTaskSource(stateManager),
+		local.NewTaskSource(stateManager),
 	)
 
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logrus.Fatalf("Failed to load config: %v", err)
+	}
+	authenticators, err := newAuthenticators(cfg.Auth)
+	if err != nil {
+		logrus.Fatalf("Failed to initialize authentication: %v", err)
+	}
+	if len(authenticators) == 0 {
+		logrus.Warn("No authentication is configured, the API is open to everyone.")
+	}
+
 	s := &Server{
 		taskSource:   taskSource,
 		stateManager: stateManager,
 	}
 
+	go s.runSync(syncInterval)
+	go s.runTemplates(templatesInterval)
+	if cfg.GC.Interval != nil {
+		go s.runGC(cfg.GC.Interval.Duration)
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Get("/api/tasks", s.GetTasks)
-	r.Post("/api/tasks/{id}/markers", s.PostTaskMarker)
-	r.Post("/api/tasks/{id}/parent", s.PostTaskParent)
-	r.Post("/api/goals", s.PostGoal)
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Middleware(authenticators...))
+		r.Get("/api/tasks", s.GetTasks)
+		r.Get("/api/tasks/{id}/markers", s.GetTaskMarkers)
+		r.Post("/api/tasks/{id}/markers", s.PostTaskMarker)
+		r.Delete("/api/tasks/{id}/markers/{name}", s.DeleteTaskMarker)
+		r.Get("/api/tasks/{id}/labels", s.GetTaskLabels)
+		r.Post("/api/tasks/{id}/labels", s.PostTaskLabel)
+		r.Delete("/api/tasks/{id}/labels/{key}/{value}", s.DeleteTaskLabel)
+		r.Put("/api/tasks/{id}/pin", s.PutTaskPin)
+		r.Delete("/api/tasks/{id}/pin", s.DeleteTaskPin)
+		r.Get("/api/tasks/{id}/notes", s.GetTaskNotes)
+		r.Put("/api/tasks/{id}/notes", s.PutTaskNotes)
+		r.Get("/api/marker-types", s.GetMarkerTypes)
+		r.Get("/api/history", s.GetHistory)
+		r.Post("/api/history/{id}/undo", s.PostHistoryUndo)
+		r.Get("/api/gc", s.GetGC)
+		r.Post("/api/gc", s.PostGC)
+		r.Post("/api/tasks/{id}/parent", s.PostTaskParent)
+		r.Delete("/api/tasks/{id}/parent", s.DeleteTaskParent)
+		r.Get("/api/tasks/{id}/relations", s.GetTaskRelations)
+		r.Post("/api/tasks/{id}/relations", s.PostTaskRelation)
+		r.Delete("/api/tasks/{id}/relations/{type}/{target}", s.DeleteTaskRelation)
+		r.Post("/api/tasks/{id}/actions", s.PostTaskAction)
+		r.Get("/api/goals", s.GetGoals)
+		r.Post("/api/goals", s.PostGoal)
+		r.Get("/api/goals/{id}", s.GetGoal)
+		r.Put("/api/goals/{id}", s.PutGoal)
+		r.Patch("/api/goals/{id}", s.PatchGoal)
+		r.Delete("/api/goals/{id}", s.DeleteGoal)
+		r.Get("/api/goals/{id}/progress", s.GetGoalProgress)
+		r.Get("/api/local-tasks", s.GetLocalTasks)
+		r.Post("/api/local-tasks", s.PostLocalTask)
+		r.Get("/api/local-tasks/{id}", s.GetLocalTask)
+		r.Patch("/api/local-tasks/{id}", s.PatchLocalTask)
+		r.Delete("/api/local-tasks/{id}", s.DeleteLocalTask)
+		r.Post("/api/local-tasks/{id}/complete", s.PostLocalTaskComplete)
+		r.Get("/api/templates", s.GetTemplates)
+		r.Post("/api/templates", s.PostTemplate)
+		r.Get("/api/templates/{id}", s.GetTemplate)
+		r.Put("/api/templates/{id}", s.PutTemplate)
+		r.Delete("/api/templates/{id}", s.DeleteTemplate)
+		r.Get("/api/plans/{member}/{date}", s.GetPlan)
+		r.Put("/api/plans/{member}/{date}", s.PutPlan)
+	})
 
 	staticFS, err := fs.Sub(frontend, "gypd-frontend/build")
 	if err != nil {
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/auth"
+	"github.com/dmage/gypd/calendar"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+// apiMarker converts the stored marker to the shape used in the API.
+func apiMarker(marker config.Marker) api.Marker {
+	return api.Marker{
+		Name:      marker.Name,
+		Until:     marker.Until,
+		Reason:    marker.Reason,
+		Author:    marker.Author,
+		CreatedAt: marker.CreatedAt,
+		RemovedBy: marker.RemovedBy,
+		RemovedAt: marker.RemovedAt,
+	}
+}
+
+// GetTaskMarkers returns the markers of the task, including expired ones. With
+// ?history=true, removed and replaced markers are returned as well.
+func (s *Server) GetTaskMarkers(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	taskState, _ := s.stateManager.GetTaskState(id)
+	stored := taskState.Markers
+	if r.URL.Query().Get("history") == "true" {
+		stored = append(stored, taskState.MarkerHistory...)
+	}
+	markers := []api.Marker{}
+	for _, marker := range stored {
+		markers = append(markers, apiMarker(marker))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(markers)
+}
+
+func (s *Server) PostTaskMarker(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var params struct {
+		Marker string `json:"marker"`
+		Until  string `json:"until"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		logrus.Errorf("Failed to decode marker: %v", err)
+		http.Error(w, "Failed to decode marker", http.StatusBadRequest)
+		return
+	}
+	markerName := params.Marker
+	if markerName == "" {
+		http.Error(w, "missing marker", http.StatusBadRequest)
+		return
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logrus.Errorf("Failed to load config: %v", err)
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+	var until *time.Time
+	if params.Until != "" {
+		cal, err := calendar.New(cfg.Calendar)
+		if err != nil {
+			logrus.Errorf("Failed to initialize calendar: %v", err)
+			http.Error(w, "Failed to initialize calendar", http.StatusInternalServerError)
+			return
+		}
+		untilTime, err := cal.ParseUntil(params.Until, time.Now())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid until: %v", err), http.StatusBadRequest)
+			return
+		}
+		until = &untilTime
+	}
+	if markerType, ok := cfg.GetMarkerType(markerName); ok {
+		if markerType.RequireUntil && until == nil {
+			http.Error(w, "marker requires until", http.StatusBadRequest)
+			return
+		}
+		if markerType.MaxDuration != nil {
+			limit := time.Now().Add(markerType.MaxDuration.Duration)
+			if until == nil {
+				until = &limit
+			} else if until.After(limit) {
+				http.Error(w, fmt.Sprintf("marker can't be set for longer than %s", markerType.MaxDuration), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	err = s.stateManager.AddTaskMarker(auth.User(r.Context()), id, config.Marker{
+		Name:   markerName,
+		Until:  until,
+		Reason: params.Reason,
+	})
+	if err != nil {
+		logrus.Errorf("Failed to save marker: %v", err)
+		http.Error(w, "Failed to save marker", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) DeleteTaskMarker(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	name := s.urlParam(r, "name")
+	if id == "" || name == "" {
+		http.Error(w, "missing id or marker", http.StatusBadRequest)
+		return
+	}
+
+	err := s.stateManager.RemoveTaskMarker(auth.User(r.Context()), id, name)
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "Marker not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to remove marker: %v", err)
+		http.Error(w, "Failed to remove marker", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) GetMarkerTypes(w http.ResponseWriter, r *http.Request) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logrus.Errorf("Failed to load config: %v", err)
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg.GetMarkerTypes())
+}
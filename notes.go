@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/dmage/gypd/auth"
+	"github.com/sirupsen/logrus"
+)
+
+// notesSnippetLength is the maximum length of the notes snippet in runes.
+const notesSnippetLength = 80
+
+// notesSnippet returns the first non-empty line of the notes, shortened to
+// notesSnippetLength.
+func notesSnippet(notes string) string {
+	for _, line := range strings.Split(notes, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		runes := []rune(line)
+		if len(runes) > notesSnippetLength {
+			return string(runes[:notesSnippetLength-1]) + "…"
+		}
+		return line
+	}
+	return ""
+}
+
+// matchesSearch reports whether every word of the query occurs in one of the
+// texts. The comparison is case-insensitive.
+func matchesSearch(query string, texts ...string) bool {
+	text := strings.ToLower(strings.Join(texts, "\n"))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+type taskNotes struct {
+	Notes string `json:"notes"`
+}
+
+func (s *Server) GetTaskNotes(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	taskState, _ := s.stateManager.GetTaskState(id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(taskNotes{Notes: taskState.Notes})
+}
+
+// PutTaskNotes replaces the notes of the task. Empty notes remove them.
+func (s *Server) PutTaskNotes(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var params taskNotes
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		logrus.Errorf("Failed to decode notes: %v", err)
+		http.Error(w, "Failed to decode notes", http.StatusBadRequest)
+		return
+	}
+
+	err := s.stateManager.SetTaskNotes(auth.User(r.Context()), id, params.Notes)
+	if err != nil {
+		logrus.Errorf("Failed to save notes: %v", err)
+		http.Error(w, "Failed to save notes", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/auth"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+var errInvalidParent = errors.New("invalid parent")
+
+func isGoal(id string, task *api.Task) bool {
+	if task != nil {
+		return task.Labels.Has("_source", "goal")
+	}
+	return strings.HasPrefix(id, "goal:")
+}
+
+// validateParent checks that parentID can become a parent of taskID: the
+// parent must exist, goals can only be children of other goals, and the task
+// must not become its own ancestor.
+func validateParent(tasks []*api.Task, taskID, parentID string) error {
+	byID := make(map[string]*api.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	if parentID == taskID {
+		return fmt.Errorf("%w: %s cannot be its own parent", errInvalidParent, taskID)
+	}
+	parent, ok := byID[parentID]
+	if !ok {
+		return fmt.Errorf("%w: task %s not found", errInvalidParent, parentID)
+	}
+	if isGoal(taskID, byID[taskID]) && !isGoal(parentID, parent) {
+		return fmt.Errorf("%w: goal %s cannot be a child of %s", errInvalidParent, taskID, parentID)
+	}
+
+	// prev maps each visited ancestor to the task it was reached from.
+	prev := map[string]string{parentID: ""}
+	queue := []string{parentID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == taskID {
+			var path []string
+			for id := taskID; id != ""; id = prev[id] {
+				path = append([]string{id}, path...)
+			}
+			path = append([]string{taskID}, path...)
+			return fmt.Errorf("%w: cycle %s", errInvalidParent, strings.Join(path, " -> "))
+		}
+		task, ok := byID[id]
+		if !ok {
+			continue
+		}
+		for _, p := range task.Labels.Get("parent") {
+			if _, seen := prev[p]; seen {
+				continue
+			}
+			prev[p] = id
+			queue = append(queue, p)
+		}
+	}
+	return nil
+}
+
+// checkParent validates parentID against the current task graph.
+func (s *Server) checkParent(taskID, parentID string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	tasks, err := s.taskSource.LoadTasks(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load tasks: %w", err)
+	}
+	updateMarkers(tasks, s.stateManager)
+	return validateParent(tasks, taskID, parentID)
+}
+
+func (s *Server) PostTaskParent(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var params struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		logrus.Errorf("Failed to decode request body: %v", err)
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if params.ID == "" {
+		http.Error(w, "missing parent id", http.StatusBadRequest)
+		return
+	}
+
+	err := s.checkParent(id, params.ID)
+	if errors.Is(err, errInvalidParent) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to validate parent: %v", err)
+		http.Error(w, "Failed to validate parent", http.StatusInternalServerError)
+		return
+	}
+
+	err = s.stateManager.SetTaskParent(auth.User(r.Context()), id, params.ID)
+	if err != nil {
+		logrus.Errorf("Failed to save parent: %v", err)
+		http.Error(w, "Failed to save parent", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) DeleteTaskParent(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	err := s.stateManager.RemoveTaskParent(auth.User(r.Context()), id, r.URL.Query().Get("id"))
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "Parent not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to remove parent: %v", err)
+		http.Error(w, "Failed to remove parent", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
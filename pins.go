@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/auth"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+func indexOf(tasks []*api.Task, id string) int {
+	for i, task := range tasks {
+		if task.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func moveTask(tasks []*api.Task, from, to int) {
+	task := tasks[from]
+	if from < to {
+		copy(tasks[from:to], tasks[from+1:to+1])
+	} else {
+		copy(tasks[to+1:from+1], tasks[to:from])
+	}
+	tasks[to] = task
+}
+
+// applyPins reorders the sorted tasks according to their pins: tasks pinned
+// to the top go first, then tasks pinned to a position are moved there, and
+// finally tasks are moved below the tasks they must stay below. Pins that
+// contradict the computed order or can't be satisfied are reported in
+// Pin.Conflict.
+func applyPins(tasks []*api.Task) []*api.Task {
+	computed := make(map[string]int, len(tasks))
+	for i, task := range tasks {
+		computed[task.ID] = i
+	}
+
+	var top, positioned, rest []*api.Task
+	for _, task := range tasks {
+		switch {
+		case task.Pin != nil && task.Pin.Top:
+			top = append(top, task)
+		case task.Pin != nil && task.Pin.Position > 0:
+			positioned = append(positioned, task)
+		default:
+			rest = append(rest, task)
+		}
+	}
+	order := append(top, rest...)
+	sort.SliceStable(positioned, func(i, j int) bool {
+		return positioned[i].Pin.Position < positioned[j].Pin.Position
+	})
+	for _, task := range positioned {
+		idx := task.Pin.Position - 1
+		if idx > len(order) {
+			idx = len(order)
+		}
+		order = append(order, nil)
+		copy(order[idx+1:], order[idx:])
+		order[idx] = task
+	}
+
+	cycle := false
+	for pass := 0; ; pass++ {
+		if pass > len(order) {
+			cycle = true
+			break
+		}
+		changed := false
+		for _, task := range append([]*api.Task(nil), order...) {
+			if task.Pin == nil {
+				continue
+			}
+			for _, id := range task.Pin.Below {
+				i, j := indexOf(order, task.ID), indexOf(order, id)
+				if j != -1 && i < j {
+					moveTask(order, i, j)
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	for i, task := range order {
+		if task.Pin == nil {
+			continue
+		}
+		task.Pin.ComputedRank = computed[task.ID] + 1
+		task.Pin.Rank = i + 1
+		task.Pin.Conflict = pinConflict(order, i, cycle)
+	}
+	return order
+}
+
+// pinConflict describes how the pin of order[i] contradicts the computed
+// order or isn't satisfied.
+func pinConflict(order []*api.Task, i int, cycle bool) string {
+	task := order[i]
+	pin := task.Pin
+	if cycle && len(pin.Below) > 0 {
+		return "the below constraints form a cycle"
+	}
+	if pin.Top {
+		for _, other := range order[:i] {
+			if other.Pin == nil || !other.Pin.Top {
+				return fmt.Sprintf("pinned to the top, but kept below %s", other.ID)
+			}
+		}
+	}
+	if pin.Position > len(order) {
+		return fmt.Sprintf("pinned to position %d, but there are only %d tasks", pin.Position, len(order))
+	}
+	if pin.Position > 0 && pin.Position != i+1 {
+		return fmt.Sprintf("pinned to position %d, but moved to %d by other pins", pin.Position, i+1)
+	}
+	for _, id := range pin.Below {
+		j := indexOf(order, id)
+		if j == -1 {
+			return fmt.Sprintf("kept below %s, which is not in the list", id)
+		}
+		if order[j].Score < task.Score {
+			return fmt.Sprintf("kept below %s, which has a lower score (%d < %d)", id, order[j].Score, task.Score)
+		}
+	}
+	overtaken := 0
+	for _, other := range order[i+1:] {
+		if other.Score > task.Score {
+			overtaken++
+		}
+	}
+	if overtaken > 0 && (pin.Top || pin.Position > 0) {
+		return fmt.Sprintf("placed above %d tasks with a higher score", overtaken)
+	}
+	return ""
+}
+
+func pinLabels(pin *config.Pin) []string {
+	var values []string
+	if pin.Top {
+		values = append(values, "top")
+	}
+	if pin.Position > 0 {
+		values = append(values, "position "+strconv.Itoa(pin.Position))
+	}
+	for _, id := range pin.Below {
+		values = append(values, "below "+id)
+	}
+	return values
+}
+
+func (s *Server) PutTaskPin(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var pin config.Pin
+	if err := json.NewDecoder(r.Body).Decode(&pin); err != nil {
+		logrus.Errorf("Failed to decode pin: %v", err)
+		http.Error(w, "Failed to decode pin", http.StatusBadRequest)
+		return
+	}
+	if pin.Position < 0 || (pin.Top && pin.Position > 0) {
+		http.Error(w, "invalid position", http.StatusBadRequest)
+		return
+	}
+	for _, below := range pin.Below {
+		if below == "" || below == id {
+			http.Error(w, "invalid below task id", http.StatusBadRequest)
+			return
+		}
+	}
+	if !pin.Top && pin.Position == 0 && len(pin.Below) == 0 {
+		http.Error(w, "empty pin", http.StatusBadRequest)
+		return
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logrus.Errorf("Failed to load config: %v", err)
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+	tasks, err := s.taskSource.LoadTasks(cfg)
+	if err != nil {
+		logrus.Errorf("Failed to load tasks: %v", err)
+		http.Error(w, "Failed to load tasks", http.StatusInternalServerError)
+		return
+	}
+	if indexOf(tasks, id) == -1 {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	for _, below := range pin.Below {
+		if indexOf(tasks, below) == -1 {
+			http.Error(w, fmt.Sprintf("task %s not found", below), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = s.stateManager.SetTaskPin(auth.User(r.Context()), id, &pin)
+	if err != nil {
+		logrus.Errorf("Failed to save pin: %v", err)
+		http.Error(w, "Failed to save pin", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) DeleteTaskPin(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	err := s.stateManager.SetTaskPin(auth.User(r.Context()), id, nil)
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "Pin not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to remove pin: %v", err)
+		http.Error(w, "Failed to remove pin", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/dmage/gypd/statestore"
+)
+
+func TestApplyPins(t *testing.T) {
+	testCases := []struct {
+		name      string
+		pins      map[string]*api.Pin
+		order     []string
+		conflicts map[string]string
+	}{
+		{
+			name:      "top",
+			pins:      map[string]*api.Pin{"d": {Top: true}},
+			order:     []string{"d", "a", "b", "c"},
+			conflicts: map[string]string{"d": "placed above 3 tasks with a higher score"},
+		},
+		{
+			name:      "position",
+			pins:      map[string]*api.Pin{"d": {Position: 2}},
+			order:     []string{"a", "d", "b", "c"},
+			conflicts: map[string]string{"d": "placed above 2 tasks with a higher score"},
+		},
+		{
+			name:      "position beyond the end",
+			pins:      map[string]*api.Pin{"a": {Position: 10}},
+			order:     []string{"b", "c", "d", "a"},
+			conflicts: map[string]string{"a": "pinned to position 10, but there are only 4 tasks"},
+		},
+		{
+			name:      "two tasks on the same position",
+			pins:      map[string]*api.Pin{"c": {Position: 1}, "d": {Position: 1}},
+			order:     []string{"d", "c", "a", "b"},
+			conflicts: map[string]string{"c": "pinned to position 1, but moved to 2 by other pins", "d": "placed above 3 tasks with a higher score"},
+		},
+		{
+			name:      "below",
+			pins:      map[string]*api.Pin{"a": {Below: []string{"c"}}},
+			order:     []string{"b", "c", "a", "d"},
+			conflicts: map[string]string{"a": "kept below c, which has a lower score (30 < 50)"},
+		},
+		{
+			name:      "below is already satisfied",
+			pins:      map[string]*api.Pin{"b": {Below: []string{"a"}}},
+			order:     []string{"a", "b", "c", "d"},
+			conflicts: map[string]string{"b": ""},
+		},
+		{
+			name:      "below wins over top",
+			pins:      map[string]*api.Pin{"d": {Top: true, Below: []string{"b"}}},
+			order:     []string{"a", "b", "d", "c"},
+			conflicts: map[string]string{"d": "pinned to the top, but kept below a"},
+		},
+		{
+			name:      "below a missing task",
+			pins:      map[string]*api.Pin{"a": {Below: []string{"x"}}},
+			order:     []string{"a", "b", "c", "d"},
+			conflicts: map[string]string{"a": "kept below x, which is not in the list"},
+		},
+		{
+			name: "below cycle",
+			pins: map[string]*api.Pin{"a": {Below: []string{"b"}}, "b": {Below: []string{"a"}}},
+			conflicts: map[string]string{
+				"a": "the below constraints form a cycle",
+				"b": "the below constraints form a cycle",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var tasks []*api.Task
+			for i, id := range []string{"a", "b", "c", "d"} {
+				tasks = append(tasks, &api.Task{ID: id, Score: 50 - 10*i, Pin: tc.pins[id]})
+			}
+
+			result := applyPins(tasks)
+
+			var order []string
+			for _, task := range result {
+				order = append(order, task.ID)
+			}
+			if tc.order != nil && !reflect.DeepEqual(order, tc.order) {
+				t.Errorf("got order %v; want %v", order, tc.order)
+			}
+			for id, want := range tc.conflicts {
+				pin := tc.pins[id]
+				if pin.Conflict != want {
+					t.Errorf("%s: got conflict %q; want %q", id, pin.Conflict, want)
+				}
+				if pin.Rank != indexOf(result, id)+1 {
+					t.Errorf("%s: got rank %d; want %d", id, pin.Rank, indexOf(result, id)+1)
+				}
+			}
+		})
+	}
+}
+
+type staticTaskSource []*api.Task
+
+func (s staticTaskSource) LoadTasks(cfg *config.Config) ([]*api.Task, error) {
+	var tasks []*api.Task
+	for _, task := range s {
+		tasks = append(tasks, task.DeepCopy())
+	}
+	return tasks, nil
+}
+
+// newTestServer creates a server with the tasks in a temporary working
+// directory with the given config.yaml.
+func newTestServer(t *testing.T, configYAML string, tasks ...*api.Task) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte(configYAML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	store, err := statestore.OpenYAML(filepath.Join(dir, "state.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := statemanager.NewStateManager(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{
+		taskSource:   staticTaskSource(tasks),
+		stateManager: sm,
+	}
+}
+
+func TestGetTasksPinsSkipHiddenTasks(t *testing.T) {
+	s := newTestServer(t, "markerTypes:\n- name: later\n  hide: true\n",
+		&api.Task{ID: "a"}, &api.Task{ID: "b"}, &api.Task{ID: "c"}, &api.Task{ID: "d"})
+	if err := s.stateManager.AddTaskMarker("alice", "a", config.Marker{Name: "later"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.stateManager.SetTaskPin("alice", "d", &config.Pin{Position: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.GetTasks(w, httptest.NewRequest("GET", "/api/tasks", nil))
+	var tasks []*api.Task
+	if err := json.NewDecoder(w.Body).Decode(&tasks); err != nil {
+		t.Fatal(err)
+	}
+
+	var order []string
+	for _, task := range tasks {
+		order = append(order, task.ID)
+	}
+	if want := []string{"b", "d", "c"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("got order %v; want %v", order, want)
+	}
+	if pin := tasks[1].Pin; pin.Rank != 2 || pin.Conflict != "" {
+		t.Errorf("got rank %d and conflict %q; want rank 2 and no conflict", pin.Rank, pin.Conflict)
+	}
+}
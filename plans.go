@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/auth"
+	"github.com/dmage/gypd/calendar"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/progress"
+	"github.com/sirupsen/logrus"
+)
+
+type planItem struct {
+	TaskID      string `json:"taskId"`
+	Summary     string `json:"summary,omitempty"`
+	Done        bool   `json:"done"`
+	CarriedOver bool   `json:"carriedOver,omitempty"`
+}
+
+// planReview shows what was planned for a day and what got done.
+type planReview struct {
+	Date    string     `json:"date"`
+	Done    []planItem `json:"done"`
+	NotDone []planItem `json:"notDone"`
+}
+
+type planResponse struct {
+	Member   string      `json:"member"`
+	Date     string      `json:"date"`
+	Items    []planItem  `json:"items"`
+	Saved    bool        `json:"saved"`
+	Previous *planReview `json:"previous,omitempty"`
+}
+
+// planParams returns the member and the date from the URL.
+func (s *Server) planParams(r *http.Request) (string, string, error) {
+	member := s.urlParam(r, "member")
+	if member == "" {
+		return "", "", fmt.Errorf("missing member")
+	}
+	if err := validateTeamMember(member); err != nil {
+		return "", "", err
+	}
+	date := s.urlParam(r, "date")
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return "", "", fmt.Errorf("invalid date %q", date)
+	}
+	return member, date, nil
+}
+
+// completedAt returns when the task was completed according to its tracker,
+// or nil if it isn't done or the time is unknown. Tasks that are no longer
+// returned by the task sources are looked up in the recorded completions.
+func (s *Server) completedAt(id string, task *api.Task) *time.Time {
+	if task != nil {
+		if !progress.IsDone(task) {
+			return nil
+		}
+		if task.Resolved != nil {
+			return task.Resolved
+		}
+	}
+	if taskState, ok := s.stateManager.GetTaskState(id); ok {
+		return taskState.DoneAt
+	}
+	return nil
+}
+
+// planItems resolves the items of a plan against the current tasks. An item
+// is done if it was checked off in the plan or if its task is done. If until
+// is set, the task must have been completed before until.
+func (s *Server) planItems(plan config.Plan, tasks map[string]*api.Task, until *time.Time) []planItem {
+	items := make([]planItem, 0, len(plan.Items))
+	for _, item := range plan.Items {
+		task := tasks[item.TaskID]
+		result := planItem{
+			TaskID: item.TaskID,
+			Done:   item.Done,
+		}
+		if task != nil {
+			result.Summary = task.Summary
+		}
+		if !result.Done {
+			if until == nil {
+				result.Done = task != nil && progress.IsDone(task)
+			} else if completed := s.completedAt(item.TaskID, task); completed != nil && completed.Before(*until) {
+				result.Done = true
+			}
+		}
+		items = append(items, result)
+	}
+	return items
+}
+
+// GetPlan returns the plan of a team member for a day. If the plan hasn't
+// been saved yet, the items of the previous planned day that are still not
+// done are carried over.
+func (s *Server) GetPlan(w http.ResponseWriter, r *http.Request) {
+	member, date, err := s.planParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logrus.Errorf("Failed to load config: %v", err)
+		http.Error(w, "Failed to load config", http.StatusInternalServerError)
+		return
+	}
+	tasks, _, err := s.getTasks(cfg, member)
+	if err != nil {
+		logrus.Errorf("Failed to get tasks: %v", err)
+		http.Error(w, "Failed to get tasks", http.StatusInternalServerError)
+		return
+	}
+	tasksByID := make(map[string]*api.Task, len(tasks))
+	for _, task := range tasks {
+		tasksByID[task.ID] = task
+	}
+
+	cal, err := calendar.New(cfg.Calendar)
+	if err != nil {
+		logrus.Errorf("Invalid calendar: %v", err)
+		http.Error(w, "Invalid calendar", http.StatusInternalServerError)
+		return
+	}
+
+	resp := planResponse{
+		Member: member,
+		Date:   date,
+		Items:  []planItem{},
+	}
+	previous, hasPrevious := s.stateManager.GetPreviousPlan(member, date)
+	if hasPrevious {
+		day, err := time.ParseInLocation("2006-01-02", previous.Date, cal.Location())
+		if err != nil {
+			logrus.Errorf("Invalid date in the plan of %s: %v", member, err)
+			http.Error(w, "Invalid plan", http.StatusInternalServerError)
+			return
+		}
+		endOfDay := day.AddDate(0, 0, 1)
+		review := &planReview{
+			Date:    previous.Date,
+			Done:    []planItem{},
+			NotDone: []planItem{},
+		}
+		for _, item := range s.planItems(previous, tasksByID, &endOfDay) {
+			if item.Done {
+				review.Done = append(review.Done, item)
+			} else {
+				review.NotDone = append(review.NotDone, item)
+			}
+		}
+		resp.Previous = review
+	}
+	if plan, ok := s.stateManager.GetPlan(member, date); ok {
+		resp.Items = s.planItems(plan, tasksByID, nil)
+		resp.Saved = true
+	} else if hasPrevious {
+		// Tasks that were finished after the previous planned day aren't
+		// carried over.
+		for _, item := range s.planItems(previous, tasksByID, nil) {
+			if !item.Done {
+				item.CarriedOver = true
+				resp.Items = append(resp.Items, item)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// PutPlan replaces the plan of a team member for a day. The items are kept in
+// the given order.
+func (s *Server) PutPlan(w http.ResponseWriter, r *http.Request) {
+	member, date, err := s.planParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Items []planItem `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logrus.Errorf("Failed to decode plan: %v", err)
+		http.Error(w, "Failed to decode plan", http.StatusBadRequest)
+		return
+	}
+	var items []config.PlanItem
+	seen := map[string]bool{}
+	for _, item := range req.Items {
+		if item.TaskID == "" {
+			http.Error(w, "missing task id", http.StatusBadRequest)
+			return
+		}
+		if seen[item.TaskID] {
+			http.Error(w, fmt.Sprintf("duplicate task %s", item.TaskID), http.StatusBadRequest)
+			return
+		}
+		seen[item.TaskID] = true
+		items = append(items, config.PlanItem{TaskID: item.TaskID, Done: item.Done})
+	}
+
+	plan := config.Plan{
+		Member: member,
+		Date:   date,
+		Items:  items,
+	}
+	if err := s.stateManager.PutPlan(auth.User(r.Context()), plan); err != nil {
+		logrus.Errorf("Failed to save plan: %v", err)
+		http.Error(w, "Failed to save plan", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
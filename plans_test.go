@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dmage/gypd/api"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPutAndGetPlan(t *testing.T) {
+	s := newTestServer(t, "team:\n- id: alice\n", &api.Task{ID: "rhbz:1", Summary: "Fix the registry"})
+	r := chi.NewRouter()
+	r.Get("/api/plans/{member}/{date}", s.GetPlan)
+	r.Put("/api/plans/{member}/{date}", s.PutPlan)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/api/plans/alice/2022-05-02", strings.NewReader(`{"items": [{"taskId": "rhbz:1"}]}`)))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/plans/alice/2022-05-02", nil))
+	var resp struct {
+		Items []map[string]interface{} `json:"items"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Items) != 1 || resp.Items[0]["taskId"] != "rhbz:1" || resp.Items[0]["summary"] != "Fix the registry" {
+		t.Errorf("got items %v", resp.Items)
+	}
+}
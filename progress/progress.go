@@ -0,0 +1,188 @@
+package progress
+
+import (
+	"time"
+
+	"github.com/dmage/gypd/api"
+)
+
+// throughputWindow is the period over which the throughput is measured.
+const throughputWindow = 28 * 24 * time.Hour
+
+// Completion records that a task was seen done while it was a descendant of
+// the ancestors.
+type Completion struct {
+	TaskID    string
+	At        time.Time
+	Ancestors []string
+}
+
+type Progress struct {
+	ID          string             `json:"id"`
+	Total       int                `json:"total"`
+	ByStatus    map[api.Status]int `json:"byStatus"`
+	Done        int                `json:"done"`
+	PercentDone int                `json:"percentDone"`
+	Blocked     int                `json:"blocked"`
+	// Throughput is the number of descendants completed per week.
+	Throughput float64    `json:"throughput"`
+	Forecast   *time.Time `json:"forecast,omitempty"`
+}
+
+// IsContainer reports whether the progress of the task should be tracked.
+func IsContainer(task *api.Task) bool {
+	return task.Labels.Has("_source", "goal") || task.Labels.Has("type", "Epic")
+}
+
+// workItems returns the tasks that are counted by the progress: tasks that
+// are not goals and have no children. An epic with stories is measured by its
+// stories.
+func workItems(tasks []*api.Task) []*api.Task {
+	parents := api.StringSet{}
+	for _, task := range tasks {
+		for _, parent := range task.Labels.Get("parent") {
+			parents.Add(parent)
+		}
+	}
+	var items []*api.Task
+	for _, task := range tasks {
+		if !task.Labels.Has("_source", "goal") && !parents.Has(task.ID) {
+			items = append(items, task)
+		}
+	}
+	return items
+}
+
+// IsDone reports whether the task has a single done status.
+func IsDone(task *api.Task) bool {
+	status := task.Labels.Get("status")
+	return len(status) == 1 && api.Status(status[0]).Done()
+}
+
+// Completions returns the completions of the work items that are done in
+// the trackers. Tasks without a known completion time are skipped, as the
+// time when gypd noticed them says nothing about the throughput.
+func Completions(tasks []*api.Task) []Completion {
+	ancestors := Ancestors(tasks)
+	var completions []Completion
+	for _, task := range workItems(tasks) {
+		if !IsDone(task) || task.Resolved == nil || len(ancestors[task.ID]) == 0 {
+			continue
+		}
+		completions = append(completions, Completion{
+			TaskID:    task.ID,
+			At:        *task.Resolved,
+			Ancestors: ancestors[task.ID],
+		})
+	}
+	return completions
+}
+
+// Ancestors returns the ancestors of every task, nearest first.
+func Ancestors(tasks []*api.Task) map[string][]string {
+	parents := map[string][]string{}
+	for _, task := range tasks {
+		parents[task.ID] = task.Labels.Get("parent")
+	}
+
+	ancestors := map[string][]string{}
+	for _, task := range tasks {
+		var result []string
+		visited := api.StringSet{task.ID: {}}
+		queue := append([]string(nil), parents[task.ID]...)
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			if visited.Has(id) {
+				continue
+			}
+			visited.Add(id)
+			result = append(result, id)
+			queue = append(queue, parents[id]...)
+		}
+		ancestors[task.ID] = result
+	}
+	return ancestors
+}
+
+// Compute returns the progress of every goal and epic.
+func Compute(tasks []*api.Task, completions []Completion, now time.Time) map[string]*Progress {
+	result := map[string]*Progress{}
+	for _, task := range tasks {
+		if IsContainer(task) {
+			result[task.ID] = &Progress{
+				ID:       task.ID,
+				ByStatus: map[api.Status]int{},
+			}
+		}
+	}
+
+	visible := api.StringSet{}
+	for _, task := range tasks {
+		visible.Add(task.ID)
+	}
+	// counted are the visible tasks whose completions count: done work
+	// items. Reopened tasks and containers are skipped.
+	counted := api.StringSet{}
+	ancestors := Ancestors(tasks)
+	for _, task := range workItems(tasks) {
+		if IsDone(task) {
+			counted.Add(task.ID)
+		}
+		statuses := task.Labels.Get("status")
+		for _, ancestor := range ancestors[task.ID] {
+			p, ok := result[ancestor]
+			if !ok {
+				continue
+			}
+			p.Total++
+			if len(statuses) == 1 {
+				status := api.Status(statuses[0])
+				p.ByStatus[status]++
+				if status.Done() {
+					p.Done++
+				}
+			}
+			if task.Labels.Has("flag", "blocked") {
+				p.Blocked++
+			}
+		}
+	}
+
+	completed := map[string]int{}
+	for _, c := range completions {
+		if visible.Has(c.TaskID) && !counted.Has(c.TaskID) {
+			continue
+		}
+		recent := now.Sub(c.At) <= throughputWindow
+		for _, ancestor := range c.Ancestors {
+			p, ok := result[ancestor]
+			if !ok {
+				continue
+			}
+			if !visible.Has(c.TaskID) {
+				// The task is no longer returned by its source, but it
+				// still counts towards the progress.
+				p.Total++
+				p.Done++
+			}
+			if recent {
+				completed[ancestor]++
+			}
+		}
+	}
+
+	for id, p := range result {
+		if p.Total > 0 {
+			p.PercentDone = p.Done * 100 / p.Total
+		}
+		p.Throughput = float64(completed[id]) / (float64(throughputWindow) / float64(7*24*time.Hour))
+		remaining := p.Total - p.Done
+		if remaining > 0 && p.Throughput > 0 {
+			weeks := float64(remaining) / p.Throughput
+			forecast := now.Add(time.Duration(weeks * float64(7*24*time.Hour))).Truncate(24 * time.Hour)
+			p.Forecast = &forecast
+		}
+	}
+	return result
+}
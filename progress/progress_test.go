@@ -0,0 +1,82 @@
+package progress
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dmage/gypd/api"
+)
+
+func newTask(id string, labels ...string) *api.Task {
+	task := &api.Task{ID: id}
+	for i := 0; i < len(labels); i += 2 {
+		task.Labels.Add(labels[i], labels[i+1])
+	}
+	return task
+}
+
+func TestCompute(t *testing.T) {
+	now := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	tasks := []*api.Task{
+		newTask("goal:g", "_source", "goal"),
+		newTask("epic", "type", "Epic", "status", "ON_DEV", "parent", "goal:g"),
+		newTask("a", "status", "NEW", "parent", "epic", "flag", "blocked"),
+		newTask("b", "status", "ON_QA", "parent", "epic"),
+		newTask("c", "status", "POST", "parent", "goal:g"),
+	}
+	completions := []Completion{
+		{TaskID: "b", At: now.Add(-24 * time.Hour), Ancestors: []string{"epic", "goal:g"}},
+		{TaskID: "gone", At: now.Add(-7 * 24 * time.Hour), Ancestors: []string{"epic", "goal:g"}},
+		{TaskID: "old", At: now.Add(-60 * 24 * time.Hour), Ancestors: []string{"goal:g"}},
+		// c was reopened.
+		{TaskID: "c", At: now.Add(-2 * 24 * time.Hour), Ancestors: []string{"goal:g"}},
+	}
+
+	result := Compute(tasks, completions, now)
+
+	goal := result["goal:g"]
+	// The epic is counted by its stories.
+	if goal.Total != 5 || goal.Done != 3 || goal.Blocked != 1 || goal.PercentDone != 60 {
+		t.Errorf("goal: got %+v", goal)
+	}
+	if goal.ByStatus[api.StatusOnDev] != 0 || goal.ByStatus[api.StatusNew] != 1 {
+		t.Errorf("goal: got statuses %v", goal.ByStatus)
+	}
+	// 2 completions in 4 weeks, 2 remaining tasks.
+	if goal.Throughput != 0.5 {
+		t.Errorf("goal: got throughput %v; want 0.5", goal.Throughput)
+	}
+	if goal.Forecast == nil || !goal.Forecast.Equal(now.Add(28*24*time.Hour).Truncate(24*time.Hour)) {
+		t.Errorf("goal: got forecast %v", goal.Forecast)
+	}
+
+	epic := result["epic"]
+	if epic.Total != 3 || epic.Done != 2 || epic.PercentDone != 66 {
+		t.Errorf("epic: got %+v", epic)
+	}
+
+	if _, ok := result["a"]; ok {
+		t.Errorf("got progress for a regular task")
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	resolved := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	tasks := []*api.Task{
+		newTask("goal:g", "_source", "goal"),
+		newTask("epic", "type", "Epic", "status", "CLOSED", "parent", "goal:g"),
+		newTask("a", "status", "CLOSED", "parent", "epic"),
+		newTask("b", "status", "CLOSED", "parent", "goal:g"),
+		newTask("c", "status", "NEW", "parent", "goal:g"),
+		newTask("d", "status", "CLOSED"),
+	}
+	for _, task := range tasks {
+		task.Resolved = &resolved
+	}
+	tasks[3].Resolved = nil
+
+	completions := Completions(tasks)
+	if len(completions) != 1 || completions[0].TaskID != "a" || !completions[0].At.Equal(resolved) || len(completions[0].Ancestors) != 2 {
+		t.Errorf("got %+v", completions)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dmage/gypd/auth"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *Server) GetTaskRelations(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	taskState, _ := s.stateManager.GetTaskState(id)
+	relations := taskState.Relations
+	if relations == nil {
+		relations = []config.Relation{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(relations)
+}
+
+func (s *Server) PostTaskRelation(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var params struct {
+		Type config.RelationType `json:"type"`
+		ID   string              `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		logrus.Errorf("Failed to decode relation: %v", err)
+		http.Error(w, "Failed to decode relation", http.StatusBadRequest)
+		return
+	}
+	if !params.Type.Valid() {
+		http.Error(w, "invalid relation type", http.StatusBadRequest)
+		return
+	}
+	if params.ID == "" || params.ID == id {
+		http.Error(w, "invalid related task id", http.StatusBadRequest)
+		return
+	}
+
+	if params.Type == config.RelationParent {
+		err := s.checkParent(id, params.ID)
+		if errors.Is(err, errInvalidParent) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			logrus.Errorf("Failed to validate parent: %v", err)
+			http.Error(w, "Failed to validate parent", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err := s.stateManager.AddTaskRelation(auth.User(r.Context()), id, config.Relation{
+		Type:   params.Type,
+		TaskID: params.ID,
+	})
+	if err != nil {
+		logrus.Errorf("Failed to save relation: %v", err)
+		http.Error(w, "Failed to save relation", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) DeleteTaskRelation(w http.ResponseWriter, r *http.Request) {
+	id := s.urlParam(r, "id")
+	relation := config.Relation{
+		Type:   config.RelationType(s.urlParam(r, "type")),
+		TaskID: s.urlParam(r, "target"),
+	}
+	if id == "" || relation.TaskID == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	err := s.stateManager.RemoveTaskRelation(auth.User(r.Context()), id, relation)
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "Relation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to remove relation: %v", err)
+		http.Error(w, "Failed to remove relation", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
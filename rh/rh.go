@@ -2,11 +2,14 @@ package rh
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/andygrunwald/go-jira"
 	"github.com/dmage/gypd/api"
 	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/tasksource"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 )
@@ -18,6 +21,13 @@ var (
 
 const epicLinkField = "customfield_12311140"
 
+const (
+	jiraTimeFormat = "2006-01-02T15:04:05.000-0700"
+	mentionWindow  = 30 * 24 * time.Hour
+)
+
+var mentionRegexp = regexp.MustCompile(`\[~([^\]]+)\]`)
+
 func newJiraClient() (*jira.Client, error) {
 	jiraToken, err := config.LoadSecret(jiraTokenFile)
 	if err != nil {
@@ -46,6 +56,20 @@ func newPriority(priority string) api.Priority {
 	return api.PriorityP1
 }
 
+func jiraPriority(priority api.Priority) (string, bool) {
+	switch priority {
+	case api.PriorityP1:
+		return "Blocker", true
+	case api.PriorityP2:
+		return "Major", true
+	case api.PriorityP3:
+		return "Normal", true
+	case api.PriorityP4:
+		return "Minor", true
+	}
+	return "", false
+}
+
 func newStatus(key, status string) api.Status {
 	if strings.HasPrefix(key, "PROJQUAY-") {
 		switch status {
@@ -82,17 +106,33 @@ func newStatus(key, status string) api.Status {
 	return api.Status(status)
 }
 
-func newAssignee(assignee *jira.User, team []config.TeamMember) string {
-	if assignee == nil {
-		return api.AssigneeNone
-	}
+func teamMember(login string, team []config.TeamMember) (string, bool) {
 	for _, member := range team {
 		for _, jiraLogin := range member.Jira {
-			if jiraLogin == assignee.Name {
-				return member.ID
+			if jiraLogin == login {
+				return member.ID, true
 			}
 		}
 	}
+	return "", false
+}
+
+func jiraLogin(assignee string, team []config.TeamMember) string {
+	for _, member := range team {
+		if member.ID == assignee && len(member.Jira) > 0 {
+			return member.Jira[0]
+		}
+	}
+	return assignee
+}
+
+func newAssignee(assignee *jira.User, team []config.TeamMember) string {
+	if assignee == nil {
+		return api.AssigneeNone
+	}
+	if id, ok := teamMember(assignee.Name, team); ok {
+		return id
+	}
 	idx := strings.Index(assignee.Name, "@")
 	if idx == -1 {
 		return assignee.Name
@@ -100,6 +140,37 @@ func newAssignee(assignee *jira.User, team []config.TeamMember) string {
 	return assignee.Name[:idx]
 }
 
+// unansweredMentions returns the team members who were mentioned in recent
+// comments and haven't commented since.
+func unansweredMentions(comments *jira.Comments, team []config.TeamMember, now time.Time) []string {
+	if comments == nil {
+		return nil
+	}
+	var pending api.StringSet
+	for _, comment := range comments.Comments {
+		created, err := time.Parse(jiraTimeFormat, comment.Created)
+		if err != nil {
+			logrus.Warnf("Failed to parse Jira comment timestamp %q: %v", comment.Created, err)
+			continue
+		}
+		if now.Sub(created) > mentionWindow {
+			continue
+		}
+		if author, ok := teamMember(comment.Author.Name, team); ok {
+			pending.Remove(author)
+		}
+		for _, match := range mentionRegexp.FindAllStringSubmatch(comment.Body, -1) {
+			if match[1] == comment.Author.Name {
+				continue
+			}
+			if id, ok := teamMember(match[1], team); ok {
+				pending.Add(id)
+			}
+		}
+	}
+	return pending.Sorted()
+}
+
 func loadEpicLinks(jiraClient *jira.Client, key string) ([]string, error) {
 	var links []string
 	err := jiraClient.Issue.SearchPages(
@@ -121,6 +192,7 @@ func loadEpicLinks(jiraClient *jira.Client, key string) ([]string, error) {
 }
 
 func convertIssue(issue jira.Issue, team []config.TeamMember, jiraClient *jira.Client) (*api.Task, error) {
+	status := newStatus(issue.Key, issue.Fields.Status.Name)
 	task := &api.Task{
 		ID:      fmt.Sprintf("rh:%s", issue.Key),
 		URL:     fmt.Sprintf("%s/browse/%s", jiraEndpoint, issue.Key),
@@ -128,15 +200,28 @@ func convertIssue(issue jira.Issue, team []config.TeamMember, jiraClient *jira.C
 		Labels: []api.KeyValue{
 			{Key: "type", Value: issue.Fields.Type.Name},
 			{Key: "priority", Value: newPriority(issue.Fields.Priority.Name).String()},
-			{Key: "status", Value: newStatus(issue.Key, issue.Fields.Status.Name).String()},
+			{Key: "status", Value: status.String()},
 			{Key: "assignee", Value: newAssignee(issue.Fields.Assignee, team)},
 		},
 	}
 
+	if created := time.Time(issue.Fields.Created); !created.IsZero() {
+		task.Created = &created
+	}
+	if resolved := time.Time(issue.Fields.Resolutiondate); !resolved.IsZero() {
+		task.Resolved = &resolved
+	} else if updated := time.Time(issue.Fields.Updated); !updated.IsZero() && status.Done() {
+		task.Resolved = &updated
+	}
+
 	if epic, err := issue.Fields.Unknowns.String(epicLinkField); err == nil {
 		task.Labels.Add("parent", fmt.Sprintf("rh:%s", epic))
 	}
 
+	for _, id := range unansweredMentions(issue.Fields.Comments, team, time.Now()) {
+		task.Labels.Add("needinfo-on", id)
+	}
+
 	if issue.Fields.Type.Name == "Epic" {
 		var err error
 		epicLinks, err := loadEpicLinks(jiraClient, issue.Key)
@@ -158,6 +243,15 @@ func NewTaskSource() TaskSource {
 	return TaskSource{}
 }
 
+var issueFields = []string{"key", "issuetype", "summary", "status", "priority", "assignee", "components", "comment", "created", "resolutiondate", "updated", epicLinkField}
+
+func parseID(id string) (string, bool) {
+	if !strings.HasPrefix(id, "rh:") {
+		return "", false
+	}
+	return strings.TrimPrefix(id, "rh:"), true
+}
+
 func (TaskSource) LoadTasks(config *config.Config) ([]*api.Task, error) {
 	if config.JiraQuery == "" {
 		logrus.Debug("No Jira query is configured.")
@@ -176,7 +270,7 @@ func (TaskSource) LoadTasks(config *config.Config) ([]*api.Task, error) {
 		&jira.SearchOptions{
 			StartAt:    0,
 			MaxResults: 50,
-			Fields:     []string{"key", "issuetype", "summary", "status", "priority", "assignee", "components", epicLinkField},
+			Fields:     issueFields,
 		},
 		func(issue jira.Issue) error {
 			task, err := convertIssue(issue, config.Team, jiraClient)
@@ -193,3 +287,116 @@ func (TaskSource) LoadTasks(config *config.Config) ([]*api.Task, error) {
 
 	return tasks, nil
 }
+
+func (TaskSource) LoadTask(config *config.Config, id string) (*api.Task, error) {
+	key, ok := parseID(id)
+	if !ok {
+		return nil, tasksource.ErrUnknownTask
+	}
+
+	jiraClient, err := newJiraClient()
+	if err != nil {
+		return nil, err
+	}
+
+	issue, _, err := jiraClient.Issue.Get(key, &jira.GetQueryOptions{
+		Fields: strings.Join(issueFields, ","),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get jira issue %s: %w", key, err)
+	}
+	return convertIssue(*issue, config.Team, jiraClient)
+}
+
+func findTransition(jiraClient *jira.Client, key string, status api.Status) (jira.Transition, error) {
+	transitions, _, err := jiraClient.Issue.GetTransitions(key)
+	if err != nil {
+		return jira.Transition{}, fmt.Errorf("failed to get transitions for %s: %w", key, err)
+	}
+	for _, t := range transitions {
+		if newStatus(key, t.To.Name) == status {
+			return t, nil
+		}
+	}
+	return jira.Transition{}, fmt.Errorf("%w: no transition to %s for %s", tasksource.ErrInvalidAction, status, key)
+}
+
+func (TaskSource) ApplyAction(config *config.Config, id string, action api.Action, dryRun bool) (string, error) {
+	key, ok := parseID(id)
+	if !ok {
+		return "", tasksource.ErrUnknownTask
+	}
+
+	jiraClient, err := newJiraClient()
+	if err != nil {
+		return "", err
+	}
+
+	switch action.Type {
+	case api.ActionAssign:
+		if action.Assignee == "" {
+			return "", fmt.Errorf("%w: missing assignee", tasksource.ErrInvalidAction)
+		}
+		login := jiraLogin(action.Assignee, config.Team)
+		description := fmt.Sprintf("assign %s to %s", key, login)
+		if dryRun {
+			return description, nil
+		}
+		if _, err := jiraClient.Issue.UpdateAssignee(key, &jira.User{Name: login}); err != nil {
+			return "", fmt.Errorf("failed to assign %s: %w", key, err)
+		}
+		return description, nil
+	case api.ActionTransition:
+		transition, err := findTransition(jiraClient, key, action.Status)
+		if err != nil {
+			return "", err
+		}
+		description := fmt.Sprintf("move %s to %s using transition %q", key, transition.To.Name, transition.Name)
+		if dryRun {
+			return description, nil
+		}
+		payload := map[string]interface{}{
+			"transition": map[string]interface{}{"id": transition.ID},
+		}
+		if action.Resolution != "" {
+			payload["fields"] = map[string]interface{}{
+				"resolution": map[string]interface{}{"name": action.Resolution},
+			}
+		}
+		if _, err := jiraClient.Issue.DoTransitionWithPayload(key, payload); err != nil {
+			return "", fmt.Errorf("failed to transition %s: %w", key, err)
+		}
+		return description, nil
+	case api.ActionSetPriority:
+		priority, ok := jiraPriority(action.Priority)
+		if !ok {
+			return "", fmt.Errorf("%w: no Jira priority for %q", tasksource.ErrInvalidAction, action.Priority)
+		}
+		description := fmt.Sprintf("set priority of %s to %s", key, priority)
+		if dryRun {
+			return description, nil
+		}
+		_, err := jiraClient.Issue.UpdateIssue(key, map[string]interface{}{
+			"fields": map[string]interface{}{
+				"priority": map[string]interface{}{"name": priority},
+			},
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to set priority of %s: %w", key, err)
+		}
+		return description, nil
+	case api.ActionComment:
+		if action.Comment == "" {
+			return "", fmt.Errorf("%w: missing comment", tasksource.ErrInvalidAction)
+		}
+		description := fmt.Sprintf("add a comment to %s", key)
+		if dryRun {
+			return description, nil
+		}
+		if _, _, err := jiraClient.Issue.AddComment(key, &jira.Comment{Body: action.Comment}); err != nil {
+			return "", fmt.Errorf("failed to add a comment to %s: %w", key, err)
+		}
+		return description, nil
+	}
+	return "", fmt.Errorf("%w: unsupported action type %q", tasksource.ErrInvalidAction, action.Type)
+}
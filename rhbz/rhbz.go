@@ -2,10 +2,13 @@ package rhbz
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dmage/gypd/api"
 	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/tasksource"
 	"github.com/eparis/bugzilla"
 	"github.com/sirupsen/logrus"
 )
@@ -32,14 +35,47 @@ func newPriority(priority string) api.Priority {
 	return api.PriorityP1
 }
 
-func newAssignee(assignee string, team []config.TeamMember) string {
+func teamMember(email string, team []config.TeamMember) (string, bool) {
 	for _, member := range team {
 		for _, bugzillaEmail := range member.Bugzilla {
-			if bugzillaEmail == assignee {
-				return member.ID
+			if bugzillaEmail == email {
+				return member.ID, true
 			}
 		}
 	}
+	return "", false
+}
+
+func bugzillaPriority(priority api.Priority) (string, bool) {
+	switch priority {
+	case api.PriorityP1:
+		return "urgent", true
+	case api.PriorityP2:
+		return "high", true
+	case api.PriorityP4:
+		return "medium", true
+	case api.PriorityP5:
+		return "low", true
+	}
+	return "", false
+}
+
+func bugzillaLogin(assignee string, team []config.TeamMember) (string, bool) {
+	for _, member := range team {
+		if member.ID == assignee && len(member.Bugzilla) > 0 {
+			return member.Bugzilla[0], true
+		}
+	}
+	if strings.Contains(assignee, "@") {
+		return assignee, true
+	}
+	return "", false
+}
+
+func newAssignee(assignee string, team []config.TeamMember) string {
+	if id, ok := teamMember(assignee, team); ok {
+		return id
+	}
 	idx := strings.Index(assignee, "@")
 	if idx == -1 {
 		return assignee
@@ -77,6 +113,17 @@ func convertBug(bug *bugzilla.Bug, team []config.TeamMember, bugzillaClient bugz
 		},
 	}
 
+	if created, err := time.Parse(time.RFC3339, bug.CreationTime); err == nil {
+		task.Created = &created
+	}
+	// Bugzilla doesn't return when the bug was closed, the last change is
+	// the closest approximation.
+	if api.Status(bug.Status).Done() {
+		if changed, err := time.Parse(time.RFC3339, bug.LastChangeTime); err == nil {
+			task.Resolved = &changed
+		}
+	}
+
 	if bug.Severity == "unspecified" || bug.Priority == "unspecified" {
 		task.Labels.Add("flag", "untriaged")
 	}
@@ -88,8 +135,10 @@ func convertBug(bug *bugzilla.Bug, team []config.TeamMember, bugzillaClient bugz
 		if flag.Name == "blocker" && flag.Status == "?" {
 			task.Labels.Add("flag", "untriaged")
 		}
-		if flag.Name == "needinfo" && newAssignee(flag.Requestee, team) == team[0].ID {
-			task.Labels.Add("flag", "needs-info")
+		if flag.Name == "needinfo" {
+			if id, ok := teamMember(flag.Requestee, team); ok {
+				task.Labels.Add("needinfo-on", id)
+			}
 		}
 	}
 
@@ -118,6 +167,19 @@ func NewTaskSource() TaskSource {
 	return TaskSource{}
 }
 
+var bugFields = []string{"id", "summary", "status", "severity", "priority", "assigned_to", "target_release", "depends_on", "flags", "creation_time", "last_change_time"}
+
+func parseID(id string) (int, bool) {
+	if !strings.HasPrefix(id, "rhbz:") {
+		return 0, false
+	}
+	bugID, err := strconv.Atoi(strings.TrimPrefix(id, "rhbz:"))
+	if err != nil {
+		return 0, false
+	}
+	return bugID, true
+}
+
 func (TaskSource) LoadTasks(cfg *config.Config) ([]*api.Task, error) {
 	if cfg.BugzillaQuery.Values().Encode() == "" {
 		logrus.Debug("No Bugzilla query is configured.")
@@ -130,7 +192,7 @@ func (TaskSource) LoadTasks(cfg *config.Config) ([]*api.Task, error) {
 	}
 
 	bugzillaQuery := cfg.BugzillaQuery
-	bugzillaQuery.IncludeFields = []string{"id", "summary", "status", "severity", "priority", "assigned_to", "target_release", "depends_on", "flags"}
+	bugzillaQuery.IncludeFields = bugFields
 
 	bugs, err := client.Search(bugzillaQuery)
 	if err != nil {
@@ -148,3 +210,81 @@ func (TaskSource) LoadTasks(cfg *config.Config) ([]*api.Task, error) {
 
 	return tasks, nil
 }
+
+func (TaskSource) LoadTask(cfg *config.Config, id string) (*api.Task, error) {
+	bugID, ok := parseID(id)
+	if !ok {
+		return nil, tasksource.ErrUnknownTask
+	}
+
+	client, err := newBugzillaClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bugzilla client: %w", err)
+	}
+
+	bug, err := client.GetBug(bugID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bug %d: %w", bugID, err)
+	}
+	return convertBug(bug, cfg.Team, client)
+}
+
+func (TaskSource) ApplyAction(cfg *config.Config, id string, action api.Action, dryRun bool) (string, error) {
+	bugID, ok := parseID(id)
+	if !ok {
+		return "", tasksource.ErrUnknownTask
+	}
+
+	var update bugzilla.BugUpdate
+	var description string
+	switch action.Type {
+	case api.ActionAssign:
+		login, ok := bugzillaLogin(action.Assignee, cfg.Team)
+		if !ok {
+			return "", fmt.Errorf("%w: no Bugzilla login for %q", tasksource.ErrInvalidAction, action.Assignee)
+		}
+		update.AssignedTo = login
+		description = fmt.Sprintf("assign bug %d to %s", bugID, login)
+	case api.ActionTransition:
+		if action.Status == "" {
+			return "", fmt.Errorf("%w: missing status", tasksource.ErrInvalidAction)
+		}
+		if !action.Status.Valid() {
+			return "", fmt.Errorf("%w: unknown status %q", tasksource.ErrInvalidAction, action.Status)
+		}
+		if action.Status == api.StatusClosed && action.Resolution == "" {
+			return "", fmt.Errorf("%w: closing a bug requires a resolution", tasksource.ErrInvalidAction)
+		}
+		update.Status = action.Status.String()
+		update.Resolution = action.Resolution
+		description = fmt.Sprintf("move bug %d to %s", bugID, action.Status)
+	case api.ActionSetPriority:
+		priority, ok := bugzillaPriority(action.Priority)
+		if !ok {
+			return "", fmt.Errorf("%w: no Bugzilla priority for %q", tasksource.ErrInvalidAction, action.Priority)
+		}
+		update.Priority = priority
+		description = fmt.Sprintf("set priority of bug %d to %s", bugID, priority)
+	case api.ActionComment:
+		if action.Comment == "" {
+			return "", fmt.Errorf("%w: missing comment", tasksource.ErrInvalidAction)
+		}
+		update.Comment = &bugzilla.BugComment{Body: action.Comment}
+		description = fmt.Sprintf("add a comment to bug %d", bugID)
+	default:
+		return "", fmt.Errorf("%w: unsupported action type %q", tasksource.ErrInvalidAction, action.Type)
+	}
+
+	if dryRun {
+		return description, nil
+	}
+
+	client, err := newBugzillaClient()
+	if err != nil {
+		return "", fmt.Errorf("failed to create bugzilla client: %w", err)
+	}
+	if err := client.UpdateBug(bugID, update); err != nil {
+		return "", fmt.Errorf("failed to update bug %d: %w", bugID, err)
+	}
+	return description, nil
+}
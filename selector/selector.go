@@ -0,0 +1,195 @@
+// Package selector implements label selectors like
+// "assignee=me,flag!=delegated,priority in (P1,P2),!marker".
+package selector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dmage/gypd/api"
+)
+
+type operator int
+
+const (
+	opEquals operator = iota
+	opNotEquals
+	opIn
+	opNotIn
+	opExists
+	opNotExists
+)
+
+type requirement struct {
+	key    string
+	op     operator
+	values []string
+}
+
+// Selector is a list of requirements that must all be satisfied.
+type Selector []requirement
+
+// splitRequirements splits s by commas that are not inside parentheses.
+func splitRequirements(s string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+			if depth > 1 {
+				return nil, fmt.Errorf("nested parentheses at position %d", i)
+			}
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unexpected ')' at position %d", i)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("missing ')'")
+	}
+	return append(parts, s[start:]), nil
+}
+
+func validKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, " \t=!(),")
+}
+
+func parseSet(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("expected a list of values in parentheses, got %q", s)
+	}
+	var values []string
+	for _, value := range strings.Split(s[1:len(s)-1], ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, fmt.Errorf("empty value in %q", s)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func parseRequirement(s string) (requirement, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "!") {
+		key := strings.TrimSpace(s[1:])
+		if !validKey(key) {
+			return requirement{}, fmt.Errorf("invalid requirement %q", s)
+		}
+		return requirement{key: key, op: opNotExists}, nil
+	}
+	if idx := strings.Index(s, "!="); idx != -1 {
+		return parseComparison(s, idx, 2, opNotEquals)
+	}
+	if idx := strings.Index(s, "=="); idx != -1 {
+		return parseComparison(s, idx, 2, opEquals)
+	}
+	if idx := strings.Index(s, "="); idx != -1 {
+		return parseComparison(s, idx, 1, opEquals)
+	}
+	if fields := strings.Fields(s); len(fields) >= 2 && (fields[1] == "in" || fields[1] == "notin") {
+		key := fields[0]
+		if !validKey(key) {
+			return requirement{}, fmt.Errorf("invalid key %q", key)
+		}
+		rest := strings.TrimSpace(s[len(key):])
+		op := opIn
+		if strings.HasPrefix(rest, "notin") {
+			op = opNotIn
+			rest = rest[len("notin"):]
+		} else {
+			rest = rest[len("in"):]
+		}
+		values, err := parseSet(rest)
+		if err != nil {
+			return requirement{}, err
+		}
+		return requirement{key: key, op: op, values: values}, nil
+	}
+	if !validKey(s) {
+		return requirement{}, fmt.Errorf("invalid requirement %q", s)
+	}
+	return requirement{key: s, op: opExists}, nil
+}
+
+func parseComparison(s string, idx, width int, op operator) (requirement, error) {
+	key := strings.TrimSpace(s[:idx])
+	value := strings.TrimSpace(s[idx+width:])
+	if !validKey(key) {
+		return requirement{}, fmt.Errorf("invalid key %q", key)
+	}
+	if value == "" || strings.ContainsAny(value, "=!(),") {
+		return requirement{}, fmt.Errorf("invalid value %q", value)
+	}
+	return requirement{key: key, op: op, values: []string{value}}, nil
+}
+
+// Parse parses a comma-separated list of requirements:
+//
+//	key=value, key==value  the task has the label
+//	key!=value             the task doesn't have the label
+//	key in (v1,v2)         the task has the label with one of the values
+//	key notin (v1,v2)      the task has the label with none of the values
+//	key                    the task has the label with any value
+//	!key                   the task doesn't have the label
+func Parse(s string) (Selector, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	parts, err := splitRequirements(s)
+	if err != nil {
+		return nil, err
+	}
+	var sel Selector
+	for _, part := range parts {
+		r, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels satisfy all requirements. The value api.Me
+// refers to the viewer.
+func (sel Selector) Matches(labels api.Labels, viewer string) bool {
+	for _, r := range sel {
+		values := labels.Get(r.key)
+		found := false
+		for _, want := range r.values {
+			if want == api.Me {
+				want = viewer
+			}
+			for _, value := range values {
+				if value == want {
+					found = true
+				}
+			}
+		}
+		var ok bool
+		switch r.op {
+		case opEquals, opIn:
+			ok = found
+		case opNotEquals, opNotIn:
+			ok = !found
+		case opExists:
+			ok = len(values) > 0
+		case opNotExists:
+			ok = len(values) == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/dmage/gypd/api"
+)
+
+func TestSelector(t *testing.T) {
+	labels := api.Labels{
+		{Key: "assignee", Value: "alice"},
+		{Key: "flag", Value: "blocker"},
+		{Key: "flag", Value: "untriaged"},
+		{Key: "priority", Value: "P2"},
+	}
+	testCases := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"assignee=me", true},
+		{"assignee==bob", false},
+		{"flag!=delegated", true},
+		{"flag!=untriaged", false},
+		{"priority in (P1, P2)", true},
+		{"priority in (P3,P4)", false},
+		{"priority notin (P3,P4)", true},
+		{"flag", true},
+		{"!marker", true},
+		{"!flag", false},
+		{"assignee=me,flag!=delegated,priority in (P1,P2),!marker", true},
+		{"assignee=me, marker", false},
+	}
+	for _, tc := range testCases {
+		sel, err := Parse(tc.selector)
+		if err != nil {
+			t.Errorf("%q: %v", tc.selector, err)
+			continue
+		}
+		if got := sel.Matches(labels, "alice"); got != tc.matches {
+			t.Errorf("%q: got %t, want %t", tc.selector, got, tc.matches)
+		}
+	}
+
+	for _, s := range []string{"priority in (P1", "priority in P1", "=P1", "flag!=", "!", "a,,b", "priority in (P1,)"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
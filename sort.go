@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dmage/gypd/api"
+)
+
+// sortKey orders tasks by a property or by the value of a label. Keys with
+// the "-" prefix reverse the order.
+type sortKey struct {
+	name    string
+	reverse bool
+}
+
+func parseSortKeys(names []string) ([]sortKey, error) {
+	keys := make([]sortKey, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := sortKey{name: name}
+		if strings.HasPrefix(name, "-") {
+			key = sortKey{name: name[1:], reverse: true}
+		}
+		if key.name == "" || strings.HasPrefix(key.name, "_") {
+			return nil, fmt.Errorf("invalid sort key %q", name)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// statusOrder puts open tasks that are further along first and done tasks
+// last.
+var statusOrder = []api.Status{
+	api.StatusModified,
+	api.StatusPost,
+	api.StatusOnDev,
+	api.StatusAssigned,
+	api.StatusNew,
+	api.StatusOnQA,
+	api.StatusVerified,
+	api.StatusClosed,
+}
+
+func statusRank(task *api.Task) int {
+	status := task.Labels.Get("status")
+	if len(status) == 1 {
+		for i, s := range statusOrder {
+			if api.Status(status[0]) == s {
+				return i
+			}
+		}
+	}
+	return len(statusOrder)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// missingLast orders the task without a value after the task with one. It
+// returns 0 if both tasks have a value or both don't.
+func missingLast(aMissing, bMissing bool) int {
+	switch {
+	case aMissing && !bMissing:
+		return 1
+	case !aMissing && bMissing:
+		return -1
+	}
+	return 0
+}
+
+// compareVersions compares dotted versions segment by segment, so that 4.9
+// goes before 4.10.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, errx := strconv.Atoi(as[i])
+		y, erry := strconv.Atoi(bs[i])
+		var c int
+		if errx == nil && erry == nil {
+			c = compareInts(x, y)
+		} else {
+			c = strings.Compare(as[i], bs[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(as), len(bs))
+}
+
+// compare compares the tasks by the key. Tasks without a value go last in
+// both directions.
+func (key sortKey) compare(a, b *api.Task) int {
+	var result int
+	switch key.name {
+	case "score":
+		result = compareInts(b.Score, a.Score)
+	case "status":
+		ra, rb := statusRank(a), statusRank(b)
+		if c := missingLast(ra == len(statusOrder), rb == len(statusOrder)); c != 0 || ra == len(statusOrder) {
+			return c
+		}
+		result = compareInts(ra, rb)
+	case "age":
+		if c := missingLast(a.Created == nil, b.Created == nil); c != 0 || a.Created == nil {
+			return c
+		}
+		switch {
+		case a.Created.Before(*b.Created):
+			result = -1
+		case b.Created.Before(*a.Created):
+			result = 1
+		}
+	case "id":
+		result = strings.Compare(a.ID, b.ID)
+	default:
+		// Other keys, like priority or assignee, are ordered by the first
+		// value of the label.
+		va, vb := a.Labels.Get(key.name), b.Labels.Get(key.name)
+		if c := missingLast(len(va) == 0, len(vb) == 0); c != 0 || len(va) == 0 {
+			return c
+		}
+		if key.name == "version" {
+			result = compareVersions(va[0], vb[0])
+		} else {
+			result = strings.Compare(va[0], vb[0])
+		}
+	}
+	if key.reverse {
+		return -result
+	}
+	return result
+}
+
+// sortTasks sorts tasks by keys. The sort is stable, so tasks that are equal
+// by all keys keep their order.
+func sortTasks(tasks []*api.Task, keys []sortKey) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		for _, key := range keys {
+			if c := key.compare(tasks[i], tasks[j]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
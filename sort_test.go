@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dmage/gypd/api"
+)
+
+func TestSortTasks(t *testing.T) {
+	testCases := []struct {
+		sort  []string
+		order []string
+	}{
+		{[]string{"version"}, []string{"a", "b", "c", "none"}},
+		{[]string{"-version"}, []string{"c", "b", "a", "none"}},
+		{[]string{"-assignee", "id"}, []string{"b", "c", "a", "none"}},
+	}
+	for _, tc := range testCases {
+		tasks := []*api.Task{
+			{ID: "none"},
+			{ID: "c", Labels: api.Labels{{Key: "version", Value: "4.10.z"}, {Key: "assignee", Value: "bob"}}},
+			{ID: "a", Labels: api.Labels{{Key: "version", Value: "4.9"}, {Key: "assignee", Value: "alice"}}},
+			{ID: "b", Labels: api.Labels{{Key: "version", Value: "4.10"}, {Key: "assignee", Value: "bob"}}},
+		}
+		keys, err := parseSortKeys(tc.sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sortTasks(tasks, keys)
+		var order []string
+		for _, task := range tasks {
+			order = append(order, task.ID)
+		}
+		if !reflect.DeepEqual(order, tc.order) {
+			t.Errorf("%s: got %v; want %v", tc.sort, order, tc.order)
+		}
+	}
+}
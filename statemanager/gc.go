@@ -0,0 +1,219 @@
+package statemanager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/progress"
+	"github.com/dmage/gypd/statestore"
+)
+
+// seenResolution limits how often LastSeen is updated for visible tasks.
+const seenResolution = time.Hour
+
+// MarkSeen records that the tasks were returned by task sources. Only tasks
+// that have local state are tracked.
+func (sm *StateManager) MarkSeen(ids []string, now time.Time) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return sm.putTaskStates(seenUpdates(sm.tasks, ids, now))
+}
+
+// seenUpdates returns the task states from tasks that change after marking
+// the tasks as seen.
+func seenUpdates(tasks map[string]config.TaskState, ids []string, now time.Time) map[string]config.TaskState {
+	updated := map[string]config.TaskState{}
+	for _, id := range ids {
+		taskState, ok := tasks[id]
+		if !ok {
+			continue
+		}
+		if taskState.LastSeen != nil && now.Sub(*taskState.LastSeen) < seenResolution {
+			continue
+		}
+		taskState = copyTaskState(taskState)
+		seen := now
+		taskState.LastSeen = &seen
+		updated[id] = taskState
+	}
+	return updated
+}
+
+// Observation is what the task sources currently report.
+type Observation struct {
+	// Seen are the IDs of all tasks from the task sources.
+	Seen []string
+	// Completions are the done tasks, Reopened are the tasks that are not
+	// done.
+	Completions []progress.Completion
+	Reopened    []string
+}
+
+// observationUpdates returns the task states from tasks that change after
+// the observation.
+func observationUpdates(tasks map[string]config.TaskState, obs Observation, now time.Time) map[string]config.TaskState {
+	updated := seenUpdates(tasks, obs.Seen, now)
+	for id, taskState := range completionUpdates(withUpdates(tasks, updated), obs.Completions, obs.Reopened) {
+		updated[id] = taskState
+	}
+	return updated
+}
+
+// withUpdates returns a copy of tasks with the updated task states.
+func withUpdates(tasks map[string]config.TaskState, updated map[string]config.TaskState) map[string]config.TaskState {
+	if len(updated) == 0 {
+		return tasks
+	}
+	result := make(map[string]config.TaskState, len(tasks)+len(updated))
+	for id, taskState := range tasks {
+		result[id] = taskState
+	}
+	for id, taskState := range updated {
+		result[id] = taskState
+	}
+	return result
+}
+
+// Observe marks the observed tasks as seen and records their completions.
+func (sm *StateManager) Observe(obs Observation, now time.Time) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return sm.putTaskStates(observationUpdates(sm.tasks, obs, now))
+}
+
+type ArchivedMarker struct {
+	TaskID string        `json:"taskID"`
+	Marker config.Marker `json:"marker"`
+}
+
+// CompactionReport describes what was removed by the garbage collector.
+type CompactionReport struct {
+	At             time.Time        `json:"at"`
+	DryRun         bool             `json:"dryRun"`
+	ExpiredMarkers []ArchivedMarker `json:"expiredMarkers"`
+	RemovedTasks   []string         `json:"removedTasks"`
+}
+
+// seenSince reports whether the task from tasks was visible after cutoff.
+// Goals are always visible. The caller must hold sm.mu.
+func (sm *StateManager) seenSince(tasks map[string]config.TaskState, id string, cutoff time.Time) bool {
+	for _, goal := range sm.goals {
+		if goalTaskID(goal.ID) == id {
+			return true
+		}
+	}
+	taskState, ok := tasks[id]
+	return ok && (taskState.LastSeen == nil || taskState.LastSeen.After(cutoff))
+}
+
+// Compact archives expired markers and the state of tasks that haven't been
+// seen for the retention period. Completed tasks are kept while any of their
+// ancestors is still seen, so that they keep counting towards the progress.
+// Tasks that were never seen start being tracked from now. If obs is set, it
+// is applied first, as Observe does. In the dry-run mode the report is
+// generated, but the state is not modified.
+func (sm *StateManager) Compact(cfg config.GCConfig, now time.Time, obs *Observation, dryRun bool) (*CompactionReport, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	report := &CompactionReport{
+		At:             now,
+		DryRun:         dryRun,
+		ExpiredMarkers: []ArchivedMarker{},
+		RemovedTasks:   []string{},
+	}
+	cutoff := now.Add(-cfg.GetRetention())
+
+	tasks := sm.tasks
+	updated := map[string]config.TaskState{}
+	if obs != nil {
+		updated = observationUpdates(sm.tasks, *obs, now)
+		tasks = withUpdates(sm.tasks, updated)
+	}
+
+	var archive []config.ArchiveEntry
+	var removed []string
+	for id, taskState := range tasks {
+		if !sm.seenSince(tasks, id, cutoff) {
+			keep := false
+			for _, ancestor := range taskState.DoneUnder {
+				if sm.seenSince(tasks, ancestor, cutoff) {
+					keep = true
+					break
+				}
+			}
+			if !keep {
+				ts := copyTaskState(taskState)
+				removed = append(removed, id)
+				delete(updated, id)
+				archive = append(archive, config.ArchiveEntry{ArchivedAt: now, TaskID: id, TaskState: &ts})
+				continue
+			}
+		}
+
+		changed := false
+		taskState = copyTaskState(taskState)
+		var markers []config.Marker
+		for _, marker := range taskState.Markers {
+			if marker.Until != nil && !marker.Until.After(now) {
+				m := marker
+				report.ExpiredMarkers = append(report.ExpiredMarkers, ArchivedMarker{TaskID: id, Marker: m})
+				archive = append(archive, config.ArchiveEntry{ArchivedAt: now, TaskID: id, Marker: &m})
+				changed = true
+				continue
+			}
+			markers = append(markers, marker)
+		}
+		taskState.Markers = markers
+		if taskState.LastSeen == nil {
+			seen := now
+			taskState.LastSeen = &seen
+			changed = true
+		}
+		if changed {
+			updated[id] = taskState
+		}
+	}
+	sort.Strings(removed)
+	report.RemovedTasks = append(report.RemovedTasks, removed...)
+	sort.Slice(report.ExpiredMarkers, func(i, j int) bool {
+		return report.ExpiredMarkers[i].TaskID < report.ExpiredMarkers[j].TaskID
+	})
+
+	if dryRun {
+		return report, nil
+	}
+
+	if len(archive) > 0 {
+		if err := config.AppendArchive(cfg.GetArchiveFile(), archive); err != nil {
+			return nil, fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	err := sm.store.Update(func(tx statestore.Tx) error {
+		for _, id := range removed {
+			if err := tx.DeleteTaskState(id); err != nil {
+				return err
+			}
+		}
+		for _, taskState := range updated {
+			if err := tx.PutTaskState(taskState); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range removed {
+		delete(sm.tasks, id)
+	}
+	for id, taskState := range updated {
+		sm.tasks[id] = taskState
+	}
+	return report, nil
+}
@@ -0,0 +1,502 @@
+package statemanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statestore"
+)
+
+// ErrConflict is returned when an operation can't be undone because the
+// state was changed after it.
+var ErrConflict = errors.New("conflict")
+
+// Journal is an append-only log of state operations.
+type Journal struct {
+	filename string
+
+	mu     sync.Mutex
+	lastID int
+}
+
+func OpenJournal(filename string) (*Journal, error) {
+	entries, err := config.LoadJournal(filename)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		filename: filename,
+	}
+	if len(entries) > 0 {
+		j.lastID = entries[len(entries)-1].ID
+	}
+	return j, nil
+}
+
+// Append assigns an ID to the entry and writes it to the journal.
+func (j *Journal) Append(entry config.JournalEntry) (config.JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry.ID = j.lastID + 1
+	if err := config.AppendJournal(j.filename, entry); err != nil {
+		return entry, err
+	}
+	j.lastID = entry.ID
+	return entry, nil
+}
+
+// Entries returns the entries of the journal. The lock keeps it from reading
+// an entry that is still being written.
+func (j *Journal) Entries() ([]config.JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return config.LoadJournal(j.filename)
+}
+
+// journalTx records the changes made through the transaction together with
+// the previous values from the state manager.
+type journalTx struct {
+	sm         *StateManager
+	tx         statestore.Tx
+	changes    []config.JournalChange
+	goals      map[string]int
+	tasks      map[string]int
+	localTasks map[string]int
+	templates  map[string]int
+	plans      map[string]int
+}
+
+func (jtx *journalTx) goalChange(id string) *config.JournalChange {
+	if idx, ok := jtx.goals[id]; ok {
+		return &jtx.changes[idx]
+	}
+	change := config.JournalChange{GoalID: id}
+	if idx := jtx.sm.goalIndex(id); idx != -1 {
+		goal := jtx.sm.goals[idx]
+		change.GoalBefore = &goal
+	}
+	jtx.goals[id] = len(jtx.changes)
+	jtx.changes = append(jtx.changes, change)
+	return &jtx.changes[len(jtx.changes)-1]
+}
+
+func (jtx *journalTx) taskChange(id string) *config.JournalChange {
+	if idx, ok := jtx.tasks[id]; ok {
+		return &jtx.changes[idx]
+	}
+	change := config.JournalChange{TaskID: id}
+	if taskState, ok := jtx.sm.tasks[id]; ok {
+		taskState = copyTaskState(taskState)
+		change.TaskBefore = &taskState
+	}
+	jtx.tasks[id] = len(jtx.changes)
+	jtx.changes = append(jtx.changes, change)
+	return &jtx.changes[len(jtx.changes)-1]
+}
+
+func (jtx *journalTx) localTaskChange(id string) *config.JournalChange {
+	if idx, ok := jtx.localTasks[id]; ok {
+		return &jtx.changes[idx]
+	}
+	change := config.JournalChange{LocalTaskID: id}
+	if task, ok := jtx.sm.localTasks[id]; ok {
+		task = copyLocalTask(task)
+		change.LocalTaskBefore = &task
+	}
+	jtx.localTasks[id] = len(jtx.changes)
+	jtx.changes = append(jtx.changes, change)
+	return &jtx.changes[len(jtx.changes)-1]
+}
+
+func (jtx *journalTx) templateChange(id string) *config.JournalChange {
+	if idx, ok := jtx.templates[id]; ok {
+		return &jtx.changes[idx]
+	}
+	change := config.JournalChange{TemplateID: id}
+	if template, ok := jtx.sm.templates[id]; ok {
+		template = copyTemplate(template)
+		change.TemplateBefore = &template
+	}
+	jtx.templates[id] = len(jtx.changes)
+	jtx.changes = append(jtx.changes, change)
+	return &jtx.changes[len(jtx.changes)-1]
+}
+
+func (jtx *journalTx) planChange(key string) *config.JournalChange {
+	if idx, ok := jtx.plans[key]; ok {
+		return &jtx.changes[idx]
+	}
+	change := config.JournalChange{PlanKey: key}
+	if plan, ok := jtx.sm.plans[key]; ok {
+		plan = copyPlan(plan)
+		change.PlanBefore = &plan
+	}
+	jtx.plans[key] = len(jtx.changes)
+	jtx.changes = append(jtx.changes, change)
+	return &jtx.changes[len(jtx.changes)-1]
+}
+
+func (jtx *journalTx) PutGoal(goal config.Goal) error {
+	if err := jtx.tx.PutGoal(goal); err != nil {
+		return err
+	}
+	jtx.goalChange(goal.ID).GoalAfter = &goal
+	return nil
+}
+
+func (jtx *journalTx) DeleteGoal(id string) error {
+	if err := jtx.tx.DeleteGoal(id); err != nil {
+		return err
+	}
+	jtx.goalChange(id).GoalAfter = nil
+	return nil
+}
+
+func (jtx *journalTx) PutTaskState(taskState config.TaskState) error {
+	if err := jtx.tx.PutTaskState(taskState); err != nil {
+		return err
+	}
+	taskState = copyTaskState(taskState)
+	jtx.taskChange(taskState.ID).TaskAfter = &taskState
+	return nil
+}
+
+func (jtx *journalTx) DeleteTaskState(id string) error {
+	if err := jtx.tx.DeleteTaskState(id); err != nil {
+		return err
+	}
+	jtx.taskChange(id).TaskAfter = nil
+	return nil
+}
+
+func (jtx *journalTx) PutLocalTask(task config.LocalTask) error {
+	if err := jtx.tx.PutLocalTask(task); err != nil {
+		return err
+	}
+	task = copyLocalTask(task)
+	jtx.localTaskChange(task.ID).LocalTaskAfter = &task
+	return nil
+}
+
+func (jtx *journalTx) DeleteLocalTask(id string) error {
+	if err := jtx.tx.DeleteLocalTask(id); err != nil {
+		return err
+	}
+	jtx.localTaskChange(id).LocalTaskAfter = nil
+	return nil
+}
+
+func (jtx *journalTx) PutTemplate(template config.Template) error {
+	if err := jtx.tx.PutTemplate(template); err != nil {
+		return err
+	}
+	template = copyTemplate(template)
+	jtx.templateChange(template.ID).TemplateAfter = &template
+	return nil
+}
+
+func (jtx *journalTx) DeleteTemplate(id string) error {
+	if err := jtx.tx.DeleteTemplate(id); err != nil {
+		return err
+	}
+	jtx.templateChange(id).TemplateAfter = nil
+	return nil
+}
+
+func (jtx *journalTx) PutPlan(plan config.Plan) error {
+	if err := jtx.tx.PutPlan(plan); err != nil {
+		return err
+	}
+	plan = copyPlan(plan)
+	jtx.planChange(plan.Key()).PlanAfter = &plan
+	return nil
+}
+
+func (jtx *journalTx) DeletePlan(key string) error {
+	if err := jtx.tx.DeletePlan(key); err != nil {
+		return err
+	}
+	jtx.planChange(key).PlanAfter = nil
+	return nil
+}
+
+// SetLastLocalTaskID is not journaled: undoing the creation of a local task
+// must not make its ID available again.
+func (jtx *journalTx) SetLastLocalTaskID(id int) error {
+	return jtx.tx.SetLastLocalTaskID(id)
+}
+
+// applyChanges applies the changes to the in-memory state. The caller must
+// hold sm.mu.
+func (sm *StateManager) applyChanges(changes []config.JournalChange) {
+	for _, change := range changes {
+		if change.GoalID != "" {
+			idx := sm.goalIndex(change.GoalID)
+			switch {
+			case change.GoalAfter == nil && idx != -1:
+				sm.goals = append(sm.goals[:idx:idx], sm.goals[idx+1:]...)
+			case change.GoalAfter != nil && idx != -1:
+				sm.goals[idx] = *change.GoalAfter
+			case change.GoalAfter != nil:
+				sm.goals = append(sm.goals, *change.GoalAfter)
+			}
+		}
+		if change.TaskID != "" {
+			if change.TaskAfter == nil {
+				delete(sm.tasks, change.TaskID)
+			} else {
+				sm.tasks[change.TaskID] = *change.TaskAfter
+			}
+		}
+		if change.LocalTaskID != "" {
+			if change.LocalTaskAfter == nil {
+				delete(sm.localTasks, change.LocalTaskID)
+			} else {
+				sm.localTasks[change.LocalTaskID] = *change.LocalTaskAfter
+			}
+		}
+		if change.TemplateID != "" {
+			if change.TemplateAfter == nil {
+				delete(sm.templates, change.TemplateID)
+			} else {
+				sm.templates[change.TemplateID] = *change.TemplateAfter
+			}
+		}
+		if change.PlanKey != "" {
+			if change.PlanAfter == nil {
+				delete(sm.plans, change.PlanKey)
+			} else {
+				sm.plans[change.PlanKey] = *change.PlanAfter
+			}
+		}
+	}
+}
+
+// update runs fn in a store transaction, applies the changes to the
+// in-memory state and records them in the journal. The caller must hold
+// sm.mu.
+func (sm *StateManager) update(entry config.JournalEntry, fn func(tx statestore.Tx) error) (config.JournalEntry, error) {
+	var jtx *journalTx
+	err := sm.store.Update(func(tx statestore.Tx) error {
+		jtx = &journalTx{
+			sm:         sm,
+			tx:         tx,
+			goals:      map[string]int{},
+			tasks:      map[string]int{},
+			localTasks: map[string]int{},
+			templates:  map[string]int{},
+			plans:      map[string]int{},
+		}
+		return fn(jtx)
+	})
+	if err != nil {
+		return entry, err
+	}
+	sm.applyChanges(jtx.changes)
+
+	if sm.journal == nil || len(jtx.changes) == 0 {
+		return entry, nil
+	}
+	entry.Time = time.Now()
+	entry.Changes = jtx.changes
+	entry, err = sm.journal.Append(entry)
+	if err != nil {
+		return entry, fmt.Errorf("state is saved, but the journal entry is lost: %w", err)
+	}
+	return entry, nil
+}
+
+// History returns the journal entries, newest first. If taskID is not
+// empty, only entries that change this task are returned.
+func (sm *StateManager) History(taskID string) ([]config.JournalEntry, error) {
+	if sm.journal == nil {
+		return nil, nil
+	}
+	entries, err := sm.journal.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var result []config.JournalEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		if taskID == "" || touchesTask(entries[i], taskID) {
+			result = append(result, entries[i])
+		}
+	}
+	return result, nil
+}
+
+func touchesTask(entry config.JournalEntry, taskID string) bool {
+	for _, change := range entry.Changes {
+		if change.TaskID == taskID ||
+			(change.GoalID != "" && goalTaskID(change.GoalID) == taskID) ||
+			(change.LocalTaskID != "" && localTaskID(change.LocalTaskID) == taskID) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutBookkeeping returns the task state without the fields that are
+// updated automatically and aren't journaled.
+func withoutBookkeeping(taskState *config.TaskState) *config.TaskState {
+	if taskState == nil {
+		return nil
+	}
+	t := *taskState
+	t.LastSeen = nil
+	t.DoneAt = nil
+	t.DoneUnder = nil
+	return &t
+}
+
+func sameJSON(a, b interface{}) bool {
+	bufA, errA := json.Marshal(a)
+	bufB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(bufA, bufB)
+}
+
+// Undo reverts the journal entry id. It fails with ErrConflict if any of the
+// objects changed by the entry was modified afterwards.
+func (sm *StateManager) Undo(user string, id int) (config.JournalEntry, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.journal == nil {
+		return config.JournalEntry{}, ErrNotFound
+	}
+	entries, err := sm.journal.Entries()
+	if err != nil {
+		return config.JournalEntry{}, err
+	}
+	var target *config.JournalEntry
+	for i := range entries {
+		if entries[i].ID == id {
+			target = &entries[i]
+			break
+		}
+	}
+	if target == nil {
+		return config.JournalEntry{}, ErrNotFound
+	}
+
+	for _, change := range target.Changes {
+		if change.GoalID != "" {
+			var current *config.Goal
+			if idx := sm.goalIndex(change.GoalID); idx != -1 {
+				current = &sm.goals[idx]
+			}
+			if !sameJSON(current, change.GoalAfter) {
+				return config.JournalEntry{}, fmt.Errorf("%w: goal %s was changed after entry %d", ErrConflict, change.GoalID, id)
+			}
+		}
+		if change.TaskID != "" {
+			var current *config.TaskState
+			if taskState, ok := sm.tasks[change.TaskID]; ok {
+				current = &taskState
+			}
+			if !sameJSON(withoutBookkeeping(current), withoutBookkeeping(change.TaskAfter)) {
+				return config.JournalEntry{}, fmt.Errorf("%w: task %s was changed after entry %d", ErrConflict, change.TaskID, id)
+			}
+		}
+		if change.LocalTaskID != "" {
+			var current *config.LocalTask
+			if task, ok := sm.localTasks[change.LocalTaskID]; ok {
+				current = &task
+			}
+			if !sameJSON(current, change.LocalTaskAfter) {
+				return config.JournalEntry{}, fmt.Errorf("%w: local task %s was changed after entry %d", ErrConflict, change.LocalTaskID, id)
+			}
+		}
+		if change.TemplateID != "" {
+			var current *config.Template
+			if template, ok := sm.templates[change.TemplateID]; ok {
+				current = &template
+			}
+			if !sameJSON(current, change.TemplateAfter) {
+				return config.JournalEntry{}, fmt.Errorf("%w: template %s was changed after entry %d", ErrConflict, change.TemplateID, id)
+			}
+		}
+		if change.PlanKey != "" {
+			var current *config.Plan
+			if plan, ok := sm.plans[change.PlanKey]; ok {
+				current = &plan
+			}
+			if !sameJSON(current, change.PlanAfter) {
+				return config.JournalEntry{}, fmt.Errorf("%w: plan %s was changed after entry %d", ErrConflict, change.PlanKey, id)
+			}
+		}
+	}
+
+	return sm.update(config.JournalEntry{User: user, Operation: "undo", Undoes: id}, func(tx statestore.Tx) error {
+		for i := len(target.Changes) - 1; i >= 0; i-- {
+			change := target.Changes[i]
+			if change.GoalID != "" {
+				var err error
+				if change.GoalBefore == nil {
+					err = tx.DeleteGoal(change.GoalID)
+				} else {
+					err = tx.PutGoal(*change.GoalBefore)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if change.TaskID != "" {
+				if change.TaskBefore == nil {
+					if err := tx.DeleteTaskState(change.TaskID); err != nil {
+						return err
+					}
+					continue
+				}
+				taskState := copyTaskState(*change.TaskBefore)
+				if current, ok := sm.tasks[change.TaskID]; ok {
+					taskState.LastSeen = current.LastSeen
+					taskState.DoneAt = current.DoneAt
+					taskState.DoneUnder = current.DoneUnder
+				}
+				if err := tx.PutTaskState(taskState); err != nil {
+					return err
+				}
+			}
+			if change.LocalTaskID != "" {
+				var err error
+				if change.LocalTaskBefore == nil {
+					err = tx.DeleteLocalTask(change.LocalTaskID)
+				} else {
+					err = tx.PutLocalTask(*change.LocalTaskBefore)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if change.TemplateID != "" {
+				var err error
+				if change.TemplateBefore == nil {
+					err = tx.DeleteTemplate(change.TemplateID)
+				} else {
+					err = tx.PutTemplate(*change.TemplateBefore)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if change.PlanKey != "" {
+				var err error
+				if change.PlanBefore == nil {
+					err = tx.DeletePlan(change.PlanKey)
+				} else {
+					err = tx.PutPlan(*change.PlanBefore)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,129 @@
+package statemanager
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statestore"
+)
+
+func localTaskID(id string) string {
+	return "local:" + id
+}
+
+func copyLocalTask(task config.LocalTask) config.LocalTask {
+	task.Labels = append(api.Labels(nil), task.Labels...)
+	return task
+}
+
+// GetLocalTasks returns the local tasks ordered by ID.
+func (sm *StateManager) GetLocalTasks() []config.LocalTask {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	tasks := make([]config.LocalTask, 0, len(sm.localTasks))
+	for _, task := range sm.localTasks {
+		tasks = append(tasks, copyLocalTask(task))
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		a, _ := strconv.Atoi(tasks[i].ID)
+		b, _ := strconv.Atoi(tasks[j].ID)
+		if a != b {
+			return a < b
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks
+}
+
+func (sm *StateManager) GetLocalTask(id string) (config.LocalTask, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	task, ok := sm.localTasks[id]
+	if !ok {
+		return config.LocalTask{}, false
+	}
+	return copyLocalTask(task), true
+}
+
+// setCompletedAt updates the completion time of the task after a status
+// change.
+func setCompletedAt(task *config.LocalTask, wasDone bool, now time.Time) {
+	if !task.Status.Done() {
+		task.CompletedAt = nil
+	} else if !wasDone || task.CompletedAt == nil {
+		task.CompletedAt = &now
+	}
+}
+
+// AddLocalTask creates a local task with a new ID and returns it.
+func (sm *StateManager) AddLocalTask(user string, task config.LocalTask) (config.LocalTask, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	now := time.Now()
+	id := sm.lastLocalTaskID + 1
+	task.ID = strconv.Itoa(id)
+	if task.Status == "" {
+		task.Status = api.StatusNew
+	}
+	task.CreatedBy = user
+	task.CreatedAt = &now
+	setCompletedAt(&task, false, now)
+
+	_, err := sm.update(config.JournalEntry{User: user, Operation: "add-local-task"}, func(tx statestore.Tx) error {
+		if err := tx.PutLocalTask(task); err != nil {
+			return err
+		}
+		return tx.SetLastLocalTaskID(id)
+	})
+	if err != nil {
+		return config.LocalTask{}, err
+	}
+	sm.lastLocalTaskID = id
+	return task, nil
+}
+
+// UpdateLocalTask replaces the local task with the same ID. The creation
+// metadata is preserved and the completion time is updated when the task
+// becomes done.
+func (sm *StateManager) UpdateLocalTask(user string, task config.LocalTask) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	old, ok := sm.localTasks[task.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	task.CreatedBy = old.CreatedBy
+	task.CreatedAt = old.CreatedAt
+	task.CompletedAt = old.CompletedAt
+	setCompletedAt(&task, old.Status.Done(), time.Now())
+
+	_, err := sm.update(config.JournalEntry{User: user, Operation: "update-local-task"}, func(tx statestore.Tx) error {
+		return tx.PutLocalTask(task)
+	})
+	return err
+}
+
+// DeleteLocalTask deletes the local task together with its task state.
+func (sm *StateManager) DeleteLocalTask(user string, id string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, ok := sm.localTasks[id]; !ok {
+		return ErrNotFound
+	}
+	_, err := sm.update(config.JournalEntry{User: user, Operation: "delete-local-task"}, func(tx statestore.Tx) error {
+		if err := tx.DeleteLocalTask(id); err != nil {
+			return err
+		}
+		if _, ok := sm.tasks[localTaskID(id)]; ok {
+			return tx.DeleteTaskState(localTaskID(id))
+		}
+		return nil
+	})
+	return err
+}
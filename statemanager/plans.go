@@ -0,0 +1,55 @@
+package statemanager
+
+import (
+	"time"
+
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statestore"
+)
+
+func copyPlan(plan config.Plan) config.Plan {
+	plan.Items = append([]config.PlanItem(nil), plan.Items...)
+	return plan
+}
+
+func (sm *StateManager) GetPlan(member, date string) (config.Plan, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	plan, ok := sm.plans[config.Plan{Member: member, Date: date}.Key()]
+	if !ok {
+		return config.Plan{}, false
+	}
+	return copyPlan(plan), true
+}
+
+// GetPreviousPlan returns the latest plan of the member before date. Dates
+// have the form YYYY-MM-DD, so they can be compared as strings.
+func (sm *StateManager) GetPreviousPlan(member, date string) (config.Plan, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	var previous config.Plan
+	found := false
+	for _, plan := range sm.plans {
+		if plan.Member == member && plan.Date < date && (!found || plan.Date > previous.Date) {
+			previous = plan
+			found = true
+		}
+	}
+	if !found {
+		return config.Plan{}, false
+	}
+	return copyPlan(previous), true
+}
+
+func (sm *StateManager) PutPlan(user string, plan config.Plan) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	now := time.Now()
+	plan.UpdatedBy = user
+	plan.UpdatedAt = &now
+	_, err := sm.update(config.JournalEntry{User: user, Operation: "put-plan"}, func(tx statestore.Tx) error {
+		return tx.PutPlan(plan)
+	})
+	return err
+}
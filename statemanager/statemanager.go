@@ -1,88 +1,572 @@
 package statemanager
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dmage/gypd/api"
 	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/progress"
+	"github.com/dmage/gypd/statestore"
+)
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
 )
 
+// StateManager holds the local state. It is safe for concurrent use.
 type StateManager struct {
-	state *config.State
+	store   statestore.Store
+	journal *Journal
+
+	mu         sync.RWMutex
+	goals      []config.Goal
+	tasks      map[string]config.TaskState
+	localTasks map[string]config.LocalTask
+	templates  map[string]config.Template
+	plans      map[string]config.Plan
+
+	lastLocalTaskID int
 }
 
-func NewStateManager() (*StateManager, error) {
-	state, err := config.LoadState()
+// NewStateManager loads the state from the store. If journal is not nil,
+// changes made by users are recorded in it.
+func NewStateManager(store statestore.Store, journal *Journal) (*StateManager, error) {
+	state, err := store.Load()
 	if err != nil {
 		return nil, err
 	}
-	return &StateManager{
-		state: state,
-	}, nil
+	sm := &StateManager{
+		store:      store,
+		journal:    journal,
+		goals:      state.Goals,
+		tasks:      make(map[string]config.TaskState, len(state.Tasks)),
+		localTasks: make(map[string]config.LocalTask, len(state.LocalTasks)),
+		templates:  make(map[string]config.Template, len(state.Templates)),
+		plans:      make(map[string]config.Plan, len(state.Plans)),
+	}
+	for _, taskState := range state.Tasks {
+		sm.tasks[taskState.ID] = taskState
+	}
+	sm.lastLocalTaskID = state.LastLocalTaskID
+	for _, task := range state.LocalTasks {
+		sm.localTasks[task.ID] = task
+		if n, err := strconv.Atoi(task.ID); err == nil && n > sm.lastLocalTaskID {
+			sm.lastLocalTaskID = n
+		}
+	}
+	for _, template := range state.Templates {
+		sm.templates[template.ID] = template
+	}
+	for _, plan := range state.Plans {
+		sm.plans[plan.Key()] = plan
+	}
+	return sm, nil
 }
 
-func (sm *StateManager) flush() error {
-	return config.SaveState(sm.state)
+func (sm *StateManager) GetGoals() []config.Goal {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	goals := make([]config.Goal, len(sm.goals))
+	copy(goals, sm.goals)
+	return goals
 }
 
-func (sm *StateManager) GetGoals() []config.Goal {
-	return sm.state.Goals
+func (sm *StateManager) GetGoal(id string) (config.Goal, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	idx := sm.goalIndex(id)
+	if idx == -1 {
+		return config.Goal{}, false
+	}
+	return sm.goals[idx], true
+}
+
+// goalIndex returns the index of the goal in sm.goals, or -1. The caller must
+// hold sm.mu.
+func (sm *StateManager) goalIndex(id string) int {
+	for i, g := range sm.goals {
+		if g.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func goalTaskID(id string) string {
+	return fmt.Sprintf("goal:%s", id)
+}
+
+func copyTaskState(taskState config.TaskState) config.TaskState {
+	taskState.Markers = append([]config.Marker(nil), taskState.Markers...)
+	taskState.MarkerHistory = append([]config.Marker(nil), taskState.MarkerHistory...)
+	taskState.Relations = append([]config.Relation(nil), taskState.Relations...)
+	taskState.Labels = append(api.Labels(nil), taskState.Labels...)
+	if taskState.Pin != nil {
+		pin := *taskState.Pin
+		pin.Below = append([]string(nil), pin.Below...)
+		taskState.Pin = &pin
+	}
+	taskState.DoneUnder = append([]string(nil), taskState.DoneUnder...)
+	return taskState
 }
 
 func (sm *StateManager) GetTaskState(id string) (config.TaskState, bool) {
-	for _, taskState := range sm.state.Tasks {
-		if taskState.ID == id {
-			return taskState, true
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	taskState, ok := sm.tasks[id]
+	if !ok {
+		return config.TaskState{}, false
+	}
+	return copyTaskState(taskState), true
+}
+
+// updateTaskState applies fn to a copy of the task state, records who
+// modified it and persists the result. The caller must hold sm.mu.
+func (sm *StateManager) updateTaskState(operation string, id string, user string, fn func(taskState *config.TaskState)) error {
+	taskState, ok := sm.tasks[id]
+	if ok {
+		taskState = copyTaskState(taskState)
+	} else {
+		taskState = config.TaskState{ID: id}
+	}
+
+	fn(&taskState)
+	now := time.Now()
+	taskState.UpdatedBy = user
+	taskState.UpdatedAt = &now
+
+	_, err := sm.update(config.JournalEntry{User: user, Operation: operation}, func(tx statestore.Tx) error {
+		return tx.PutTaskState(taskState)
+	})
+	return err
+}
+
+// retireMarker moves the marker to the history of the task.
+func retireMarker(taskState *config.TaskState, marker config.Marker, user string, now time.Time) {
+	marker.RemovedBy = user
+	marker.RemovedAt = &now
+	taskState.MarkerHistory = append(taskState.MarkerHistory, marker)
+}
+
+// AddTaskMarker adds the marker to the task, or replaces the marker with the
+// same name. The author and the creation time are set by the state manager.
+func (sm *StateManager) AddTaskMarker(user string, taskID string, marker config.Marker) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	now := time.Now()
+	marker.Author = user
+	marker.CreatedAt = &now
+	marker.RemovedBy = ""
+	marker.RemovedAt = nil
+
+	return sm.updateTaskState("add-marker", taskID, user, func(taskState *config.TaskState) {
+		for i, m := range taskState.Markers {
+			if m.Name == marker.Name {
+				retireMarker(taskState, m, user, now)
+				taskState.Markers[i] = marker
+				return
+			}
+		}
+		taskState.Markers = append(taskState.Markers, marker)
+	})
+}
+
+// RemoveTaskMarker removes the marker from the task and keeps it in the
+// history.
+func (sm *StateManager) RemoveTaskMarker(user string, taskID string, name string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	taskState, ok := sm.tasks[taskID]
+	if !ok {
+		return ErrNotFound
+	}
+	found := false
+	for _, m := range taskState.Markers {
+		if m.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	return sm.updateTaskState("remove-marker", taskID, user, func(taskState *config.TaskState) {
+		for i, m := range taskState.Markers {
+			if m.Name == name {
+				retireMarker(taskState, m, user, now)
+				taskState.Markers = append(taskState.Markers[:i], taskState.Markers[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+func (sm *StateManager) SetTaskParent(user string, taskID string, parentID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return sm.updateTaskState("set-parent", taskID, user, func(taskState *config.TaskState) {
+		taskState.ParentID = parentID
+	})
+}
+
+// RemoveTaskParent detaches the task from the parent parentID, which can be
+// either the parent set by SetTaskParent or a parent relation. An empty
+// parentID removes the parent set by SetTaskParent.
+func (sm *StateManager) RemoveTaskParent(user string, taskID string, parentID string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	taskState, ok := sm.tasks[taskID]
+	if !ok {
+		return ErrNotFound
+	}
+	if taskState.ParentID != "" && (parentID == "" || taskState.ParentID == parentID) {
+		return sm.updateTaskState("remove-parent", taskID, user, func(taskState *config.TaskState) {
+			taskState.ParentID = ""
+		})
+	}
+	relation := config.Relation{Type: config.RelationParent, TaskID: parentID}
+	for i, r := range taskState.Relations {
+		if parentID != "" && r == relation {
+			return sm.updateTaskState("remove-parent", taskID, user, func(taskState *config.TaskState) {
+				taskState.Relations = append(taskState.Relations[:i], taskState.Relations[i+1:]...)
+			})
+		}
+	}
+	return ErrNotFound
+}
+
+func (sm *StateManager) SetTaskNotes(user string, taskID string, notes string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	return sm.updateTaskState("set-notes", taskID, user, func(taskState *config.TaskState) {
+		taskState.Notes = notes
+	})
+}
+
+// AddTaskLabel adds the label to the task. Adding an existing label is a
+// no-op.
+func (sm *StateManager) AddTaskLabel(user string, taskID string, label api.KeyValue) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if taskState, ok := sm.tasks[taskID]; ok && taskState.Labels.Has(label.Key, label.Value) {
+		return nil
+	}
+
+	return sm.updateTaskState("add-label", taskID, user, func(taskState *config.TaskState) {
+		taskState.Labels.Add(label.Key, label.Value)
+	})
+}
+
+func (sm *StateManager) RemoveTaskLabel(user string, taskID string, label api.KeyValue) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	taskState, ok := sm.tasks[taskID]
+	if !ok || !taskState.Labels.Has(label.Key, label.Value) {
+		return ErrNotFound
+	}
+
+	return sm.updateTaskState("remove-label", taskID, user, func(taskState *config.TaskState) {
+		labels := taskState.Labels[:0]
+		for _, l := range taskState.Labels {
+			if l != label {
+				labels = append(labels, l)
+			}
+		}
+		taskState.Labels = labels
+	})
+}
+
+// SetTaskPin sets the pin of the task. A nil pin unpins the task.
+func (sm *StateManager) SetTaskPin(user string, taskID string, pin *config.Pin) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if pin == nil {
+		if taskState, ok := sm.tasks[taskID]; !ok || taskState.Pin == nil {
+			return ErrNotFound
+		}
+		return sm.updateTaskState("unpin", taskID, user, func(taskState *config.TaskState) {
+			taskState.Pin = nil
+		})
+	}
+	return sm.updateTaskState("pin", taskID, user, func(taskState *config.TaskState) {
+		taskState.Pin = pin
+	})
+}
+
+func hasRelation(relations []config.Relation, relation config.Relation) bool {
+	for _, r := range relations {
+		if r == relation {
+			return true
 		}
 	}
-	return config.TaskState{}, false
+	return false
 }
 
-func (sm *StateManager) getOrCreateTaskState(id string) *config.TaskState {
-	var taskState *config.TaskState
-	for i, ts := range sm.state.Tasks {
-		if ts.ID == id {
-			taskState = &sm.state.Tasks[i]
+func hasRelationTo(relations []config.Relation, taskID string) bool {
+	for _, r := range relations {
+		if r.TaskID == taskID {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTaskRelation adds the relation to the task. Adding an existing relation
+// is a no-op.
+func (sm *StateManager) AddTaskRelation(user string, taskID string, relation config.Relation) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if taskState, ok := sm.tasks[taskID]; ok && hasRelation(taskState.Relations, relation) {
+		return nil
+	}
+
+	return sm.updateTaskState("add-relation", taskID, user, func(taskState *config.TaskState) {
+		taskState.Relations = append(taskState.Relations, relation)
+	})
+}
+
+func (sm *StateManager) RemoveTaskRelation(user string, taskID string, relation config.Relation) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	taskState, ok := sm.tasks[taskID]
+	if !ok {
+		return ErrNotFound
+	}
+	idx := -1
+	for i, r := range taskState.Relations {
+		if r == relation {
+			idx = i
 			break
 		}
 	}
-	if taskState == nil {
-		sm.state.Tasks = append(sm.state.Tasks, config.TaskState{ID: id})
-		taskState = &sm.state.Tasks[len(sm.state.Tasks)-1]
+	if idx == -1 {
+		return ErrNotFound
 	}
-	return taskState
+
+	return sm.updateTaskState("remove-relation", taskID, user, func(taskState *config.TaskState) {
+		taskState.Relations = append(taskState.Relations[:idx], taskState.Relations[idx+1:]...)
+	})
+}
+
+func (sm *StateManager) AddGoal(user string, goal config.Goal) (bool, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.goalIndex(goal.ID) != -1 {
+		return false, nil
+	}
+	now := time.Now()
+	goal.CreatedBy = user
+	goal.CreatedAt = &now
+	_, err := sm.update(config.JournalEntry{User: user, Operation: "add-goal"}, func(tx statestore.Tx) error {
+		return tx.PutGoal(goal)
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// reparentChildren changes the parent of every task whose parent is
+// oldParentID, and retargets the relations to oldParentID. An empty
+// newParentID detaches the tasks and removes the relations. The caller must
+// hold sm.mu.
+func (sm *StateManager) reparentChildren(tx statestore.Tx, user string, oldParentID, newParentID string) error {
+	now := time.Now()
+	for _, taskState := range sm.tasks {
+		changed := false
+		if taskState.ParentID == oldParentID {
+			taskState = copyTaskState(taskState)
+			taskState.ParentID = newParentID
+			if newParentID == taskState.ID {
+				taskState.ParentID = ""
+			}
+			changed = true
+		}
+		if hasRelationTo(taskState.Relations, oldParentID) {
+			if !changed {
+				taskState = copyTaskState(taskState)
+			}
+			var relations []config.Relation
+			for _, relation := range taskState.Relations {
+				if relation.TaskID == oldParentID {
+					if newParentID == "" || newParentID == taskState.ID {
+						continue
+					}
+					relation.TaskID = newParentID
+				}
+				if !hasRelation(relations, relation) {
+					relations = append(relations, relation)
+				}
+			}
+			taskState.Relations = relations
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		taskState.UpdatedBy = user
+		taskState.UpdatedAt = &now
+		if err := tx.PutTaskState(taskState); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (sm *StateManager) AddTaskMarker(taskID string, marker config.Marker) error {
-	taskState := sm.getOrCreateTaskState(taskID)
+// UpdateGoal replaces the goal with the given ID. If goal.ID differs from id,
+// the goal is renamed and its children are moved to the new ID.
+func (sm *StateManager) UpdateGoal(user string, id string, goal config.Goal) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	idx := sm.goalIndex(id)
+	if idx == -1 {
+		return ErrNotFound
+	}
+	if goal.ID != id && sm.goalIndex(goal.ID) != -1 {
+		return ErrAlreadyExists
+	}
+	goal.CreatedBy = sm.goals[idx].CreatedBy
+	goal.CreatedAt = sm.goals[idx].CreatedAt
 
-	var taskMarker *config.Marker
-	for i, m := range taskState.Markers {
-		if m.Name == marker.Name {
-			taskMarker = &taskState.Markers[i]
+	_, err := sm.update(config.JournalEntry{User: user, Operation: "update-goal"}, func(tx statestore.Tx) error {
+		if goal.ID != id {
+			if err := tx.DeleteGoal(id); err != nil {
+				return err
+			}
+			if err := sm.reparentChildren(tx, user, goalTaskID(id), goalTaskID(goal.ID)); err != nil {
+				return err
+			}
 		}
+		return tx.PutGoal(goal)
+	})
+	return err
+}
+
+// DeleteGoal deletes the goal. Its children are moved to the goal
+// reassignTo, or detached if reassignTo is empty.
+func (sm *StateManager) DeleteGoal(user string, id string, reassignTo string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	idx := sm.goalIndex(id)
+	if idx == -1 {
+		return ErrNotFound
 	}
-	if taskMarker == nil {
-		taskState.Markers = append(taskState.Markers, config.Marker{Name: marker.Name})
-		taskMarker = &taskState.Markers[len(taskState.Markers)-1]
+	newParentID := ""
+	if reassignTo != "" {
+		if reassignTo == id || sm.goalIndex(reassignTo) == -1 {
+			return fmt.Errorf("goal %q to reassign children to: %w", reassignTo, ErrNotFound)
+		}
+		newParentID = goalTaskID(reassignTo)
 	}
 
-	taskMarker.Until = marker.Until
+	_, err := sm.update(config.JournalEntry{User: user, Operation: "delete-goal"}, func(tx statestore.Tx) error {
+		if err := sm.reparentChildren(tx, user, goalTaskID(id), newParentID); err != nil {
+			return err
+		}
+		return tx.DeleteGoal(id)
+	})
+	return err
+}
 
-	return sm.flush()
+// GetCompletions returns the tasks that were seen done.
+func (sm *StateManager) GetCompletions() []progress.Completion {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	var completions []progress.Completion
+	for _, taskState := range sm.tasks {
+		if taskState.DoneAt == nil {
+			continue
+		}
+		completions = append(completions, progress.Completion{
+			TaskID:    taskState.ID,
+			At:        *taskState.DoneAt,
+			Ancestors: append([]string(nil), taskState.DoneUnder...),
+		})
+	}
+	return completions
 }
 
-func (sm *StateManager) SetTaskParent(taskID string, parentID string) error {
-	taskState := sm.getOrCreateTaskState(taskID)
+// RecordCompletions remembers when tasks were done, so that they keep
+// counting after they disappear from the task sources. The completions of the
+// reopened tasks are forgotten.
+func (sm *StateManager) RecordCompletions(completions []progress.Completion, reopened []string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	taskState.ParentID = parentID
+	return sm.putTaskStates(completionUpdates(sm.tasks, completions, reopened))
+}
 
-	return sm.flush()
+// completionUpdates returns the task states from tasks that change after
+// recording the completions.
+func completionUpdates(tasks map[string]config.TaskState, completions []progress.Completion, reopened []string) map[string]config.TaskState {
+	updated := map[string]config.TaskState{}
+	for _, id := range reopened {
+		taskState, ok := tasks[id]
+		if !ok || taskState.DoneAt == nil {
+			continue
+		}
+		taskState = copyTaskState(taskState)
+		taskState.DoneAt = nil
+		taskState.DoneUnder = nil
+		updated[id] = taskState
+	}
+	for _, c := range completions {
+		taskState, ok := tasks[c.TaskID]
+		if ok && taskState.DoneAt != nil && taskState.DoneAt.Equal(c.At) {
+			continue
+		}
+		if ok {
+			taskState = copyTaskState(taskState)
+		} else {
+			taskState = config.TaskState{ID: c.TaskID}
+		}
+		at := c.At
+		taskState.DoneAt = &at
+		taskState.DoneUnder = c.Ancestors
+		updated[c.TaskID] = taskState
+	}
+	return updated
 }
 
-func (sm *StateManager) AddGoal(goal config.Goal) (bool, error) {
-	for _, g := range sm.state.Goals {
-		if g.ID == goal.ID {
-			return false, nil
+// putTaskStates persists the task states and updates the in-memory state.
+// The caller must hold sm.mu.
+func (sm *StateManager) putTaskStates(updated map[string]config.TaskState) error {
+	if len(updated) == 0 {
+		return nil
+	}
+	err := sm.store.Update(func(tx statestore.Tx) error {
+		for _, taskState := range updated {
+			if err := tx.PutTaskState(taskState); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for id, taskState := range updated {
+		sm.tasks[id] = taskState
 	}
-	sm.state.Goals = append(sm.state.Goals, goal)
-	return true, sm.flush()
+	return nil
 }
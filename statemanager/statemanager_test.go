@@ -0,0 +1,393 @@
+package statemanager
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/progress"
+	"github.com/dmage/gypd/statestore"
+)
+
+func newTestStateManager(t *testing.T) *StateManager {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := statestore.OpenYAML(filepath.Join(dir, "state.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, err := OpenJournal(filepath.Join(dir, "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := NewStateManager(store, journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sm
+}
+
+func assertParent(t *testing.T, sm *StateManager, taskID, parentID string) {
+	t.Helper()
+	taskState, _ := sm.GetTaskState(taskID)
+	if taskState.ParentID != parentID {
+		t.Errorf("%s: got parent %q; want %q", taskID, taskState.ParentID, parentID)
+	}
+}
+
+func TestRenameAndDeleteGoal(t *testing.T) {
+	sm := newTestStateManager(t)
+	for _, id := range []string{"a", "b"} {
+		if _, err := sm.AddGoal("alice", config.Goal{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.SetTaskParent("alice", "rhbz:1", "goal:a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetTaskParent("alice", "rhbz:2", "goal:b"); err != nil {
+		t.Fatal(err)
+	}
+	// rhbz:3 belongs to both goals.
+	for _, parent := range []string{"goal:a", "goal:b"} {
+		if err := sm.AddTaskRelation("alice", "rhbz:3", config.Relation{Type: config.RelationParent, TaskID: parent}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertRelations := func(want ...string) {
+		t.Helper()
+		taskState, _ := sm.GetTaskState("rhbz:3")
+		var got []string
+		for _, relation := range taskState.Relations {
+			got = append(got, relation.TaskID)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("rhbz:3: got parents %v; want %v", got, want)
+		}
+	}
+
+	if err := sm.UpdateGoal("bob", "a", config.Goal{ID: "b"}); err != ErrAlreadyExists {
+		t.Errorf("renaming to an existing goal: got %v; want %v", err, ErrAlreadyExists)
+	}
+	if err := sm.UpdateGoal("bob", "a", config.Goal{ID: "c", Score: 5}); err != nil {
+		t.Fatal(err)
+	}
+	assertParent(t, sm, "rhbz:1", "goal:c")
+	assertRelations("goal:c", "goal:b")
+	if goal, ok := sm.GetGoal("c"); !ok || goal.Score != 5 || goal.CreatedBy != "alice" {
+		t.Errorf("got goal %+v, %t", goal, ok)
+	}
+
+	if err := sm.DeleteGoal("bob", "c", "b"); err != nil {
+		t.Fatal(err)
+	}
+	assertParent(t, sm, "rhbz:1", "goal:b")
+	assertRelations("goal:b")
+
+	if err := sm.DeleteGoal("bob", "b", ""); err != nil {
+		t.Fatal(err)
+	}
+	assertParent(t, sm, "rhbz:1", "")
+	assertParent(t, sm, "rhbz:2", "")
+	assertRelations()
+	if goals := sm.GetGoals(); len(goals) != 0 {
+		t.Errorf("got goals %+v; want none", goals)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	sm := newTestStateManager(t)
+	archiveFile := filepath.Join(t.TempDir(), "archive.jsonl")
+	retention := 10 * 24 * time.Hour
+	cfg := config.GCConfig{
+		Retention:   &config.Duration{Duration: retention},
+		ArchiveFile: archiveFile,
+	}
+	now := time.Now()
+	past := now.Add(-time.Hour)
+
+	if _, err := sm.AddGoal("alice", config.Goal{ID: "g"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"visible", "gone", "done"} {
+		if err := sm.AddTaskMarker("alice", id, config.Marker{Name: "later", Until: &past}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.RecordCompletions([]progress.Completion{{TaskID: "done", At: now, Ancestors: []string{"goal:g"}}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.MarkSeen([]string{"visible", "gone", "done"}, now.Add(-2*retention)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.MarkSeen([]string{"visible"}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := sm.Compact(cfg, now, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.RemovedTasks, []string{"gone"}) || len(report.ExpiredMarkers) != 2 {
+		t.Errorf("got report %+v", report)
+	}
+	if _, ok := sm.GetTaskState("gone"); !ok {
+		t.Errorf("dry run removed the task state")
+	}
+
+	report, err = sm.Compact(cfg, now, &Observation{Seen: []string{"gone"}}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.RemovedTasks) != 0 {
+		t.Errorf("dry run removed observed tasks: %+v", report.RemovedTasks)
+	}
+	if taskState, _ := sm.GetTaskState("gone"); taskState.LastSeen.After(now.Add(-retention)) {
+		t.Errorf("dry run marked the task as seen")
+	}
+
+	if _, err := sm.Compact(cfg, now, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sm.GetTaskState("gone"); ok {
+		t.Errorf("task state wasn't removed")
+	}
+	if taskState, _ := sm.GetTaskState("visible"); len(taskState.Markers) != 0 {
+		t.Errorf("expired markers weren't removed: %+v", taskState.Markers)
+	}
+	if _, ok := sm.GetTaskState("done"); !ok {
+		t.Errorf("completed task state was removed")
+	}
+
+	buf, err := ioutil.ReadFile(archiveFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(buf), "\n"); lines != 3 {
+		t.Errorf("got %d archive entries; want 3", lines)
+	}
+}
+
+func TestRecordCompletions(t *testing.T) {
+	sm := newTestStateManager(t)
+	resolved := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	completions := []progress.Completion{{TaskID: "a", At: resolved, Ancestors: []string{"goal:g"}}}
+	if err := sm.RecordCompletions(completions, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := sm.GetCompletions(); len(got) != 1 || !got[0].At.Equal(resolved) {
+		t.Errorf("got %+v", got)
+	}
+
+	if err := sm.RecordCompletions(nil, []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sm.GetCompletions(); len(got) != 0 {
+		t.Errorf("got %+v after reopening", got)
+	}
+	if _, ok := sm.GetTaskState("b"); ok {
+		t.Errorf("got a task state for a task without completions")
+	}
+}
+
+func TestUndo(t *testing.T) {
+	sm := newTestStateManager(t)
+	if _, err := sm.AddGoal("alice", config.Goal{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetTaskParent("alice", "rhbz:1", "goal:a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetTaskParent("bob", "rhbz:1", "rhbz:2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.DeleteGoal("bob", "a", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := sm.History("rhbz:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var operations []string
+	for _, entry := range history {
+		operations = append(operations, entry.Operation)
+	}
+	if want := []string{"set-parent", "set-parent"}; !reflect.DeepEqual(operations, want) {
+		t.Fatalf("got operations %v for rhbz:1; want %v", operations, want)
+	}
+
+	if _, err := sm.Undo("bob", history[1].ID); !errors.Is(err, ErrConflict) {
+		t.Errorf("undo of an overwritten change: got %v; want ErrConflict", err)
+	}
+
+	entry, err := sm.Undo("bob", history[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Undoes != history[0].ID {
+		t.Errorf("got undoes %d; want %d", entry.Undoes, history[0].ID)
+	}
+	assertParent(t, sm, "rhbz:1", "goal:a")
+
+	all, err := sm.History("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Undo("bob", all[1].ID); err != nil {
+		t.Fatalf("undo of goal deletion: %v", err)
+	}
+	if _, ok := sm.GetGoal("a"); !ok {
+		t.Error("goal a is not restored")
+	}
+}
+
+func TestLocalTasks(t *testing.T) {
+	sm := newTestStateManager(t)
+	for _, summary := range []string{"Review design", "Answer mail"} {
+		if _, err := sm.AddLocalTask("alice", config.LocalTask{Summary: summary}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tasks := sm.GetLocalTasks()
+	if len(tasks) != 2 || tasks[0].ID != "1" || tasks[1].ID != "2" || tasks[1].Status != api.StatusNew {
+		t.Fatalf("got %+v", tasks)
+	}
+
+	task := tasks[0]
+	task.Status = api.StatusClosed
+	if err := sm.UpdateLocalTask("bob", task); err != nil {
+		t.Fatal(err)
+	}
+	task, _ = sm.GetLocalTask("1")
+	if task.CompletedAt == nil || task.CreatedBy != "alice" {
+		t.Errorf("got %+v after completion", task)
+	}
+
+	if err := sm.DeleteLocalTask("bob", "2"); err != nil {
+		t.Fatal(err)
+	}
+	history, err := sm.History("local:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.Undo("bob", history[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if task, ok := sm.GetLocalTask("2"); !ok || task.Summary != "Answer mail" {
+		t.Errorf("got %+v, %t after undoing deletion", task, ok)
+	}
+
+	// The IDs of deleted tasks are not reused, and their state is deleted.
+	if err := sm.SetTaskNotes("bob", "local:2", "old notes"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.DeleteLocalTask("bob", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sm.GetTaskState("local:2"); ok {
+		t.Errorf("task state of a deleted local task was kept")
+	}
+	task, err = sm.AddLocalTask("alice", config.LocalTask{Summary: "New task"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.ID != "3" {
+		t.Errorf("got ID %s for a new task; want 3", task.ID)
+	}
+}
+
+func TestPlans(t *testing.T) {
+	sm := newTestStateManager(t)
+	for _, plan := range []config.Plan{
+		{Member: "alice", Date: "2022-05-02", Items: []config.PlanItem{{TaskID: "rhbz:1", Done: true}, {TaskID: "rhbz:2"}}},
+		{Member: "alice", Date: "2022-05-04", Items: []config.PlanItem{{TaskID: "rhbz:2"}}},
+		{Member: "bob", Date: "2022-05-05", Items: []config.PlanItem{{TaskID: "rhbz:3"}}},
+	} {
+		if err := sm.PutPlan("alice", plan); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if plan, ok := sm.GetPreviousPlan("alice", "2022-05-06"); !ok || plan.Date != "2022-05-04" {
+		t.Errorf("got %+v, %t as the previous plan for 2022-05-06", plan, ok)
+	}
+	if plan, ok := sm.GetPreviousPlan("alice", "2022-05-04"); !ok || plan.Date != "2022-05-02" || len(plan.Items) != 2 {
+		t.Errorf("got %+v, %t as the previous plan for 2022-05-04", plan, ok)
+	}
+	if plan, ok := sm.GetPreviousPlan("alice", "2022-05-02"); ok {
+		t.Errorf("got %+v as the previous plan for 2022-05-02", plan)
+	}
+	if plan, ok := sm.GetPlan("bob", "2022-05-05"); !ok || plan.UpdatedBy != "alice" || plan.UpdatedAt == nil {
+		t.Errorf("got %+v, %t", plan, ok)
+	}
+}
+
+func TestRunTemplates(t *testing.T) {
+	sm := newTestStateManager(t)
+	err := sm.AddTemplate("alice", config.Template{
+		ID:          "scrub",
+		Schedule:    "0 9 * * 1",
+		Summary:     "Bug scrub",
+		ParentID:    "goal:triage",
+		ExpireAfter: &config.Duration{Duration: 48 * time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2022, 4, 6, 12, 0, 0, 0, time.UTC) // Wednesday
+	sm.templates["scrub"] = func() config.Template {
+		template := sm.templates["scrub"]
+		template.CreatedAt = &created
+		return template
+	}()
+
+	// Two Mondays have passed, only one instance is created.
+	now := time.Date(2022, 4, 18, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err := sm.RunTemplates(now, time.UTC); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tasks := sm.GetLocalTasks()
+	if len(tasks) != 1 || tasks[0].Summary != "Bug scrub" || tasks[0].TemplateID != "scrub" {
+		t.Fatalf("got %+v", tasks)
+	}
+	if want := time.Date(2022, 4, 20, 9, 0, 0, 0, time.UTC); tasks[0].ExpiresAt == nil || !tasks[0].ExpiresAt.Equal(want) {
+		t.Errorf("got expiration %v; want %v", tasks[0].ExpiresAt, want)
+	}
+	assertParent(t, sm, "local:1", "goal:triage")
+
+	if err := sm.RunTemplates(now.Add(48*time.Hour), time.UTC); err != nil {
+		t.Fatal(err)
+	}
+	if tasks := sm.GetLocalTasks(); len(tasks) != 0 {
+		t.Errorf("got %+v; want the expired task to be deleted", tasks)
+	}
+	if _, ok := sm.GetTaskState("local:1"); ok {
+		t.Errorf("the state of the expired task was kept")
+	}
+}
+
+func TestLastOccurrence(t *testing.T) {
+	lastRun := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2022, 4, 18, 10, 30, 15, 0, time.UTC)
+	for schedule, want := range map[string]time.Time{
+		"* * * * *":   time.Date(2022, 4, 18, 10, 30, 0, 0, time.UTC),
+		"*/7 9 * * *": time.Date(2022, 4, 18, 9, 56, 0, 0, time.UTC),
+		"0 0 29 2 *":  {},
+		"0 0 1 1 *":   time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		template := config.Template{Schedule: schedule, LastRun: &lastRun}
+		if got := lastOccurrence(template, now, time.UTC); !got.Equal(want) {
+			t.Errorf("%s: got %v; want %v", schedule, got, want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package statemanager
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/calendar"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statestore"
+)
+
+// maxScheduleOccurrences limits how many occurrences lastOccurrence walks
+// through.
+const maxScheduleOccurrences = 100000
+
+func copyTemplate(template config.Template) config.Template {
+	template.Labels = append(api.Labels(nil), template.Labels...)
+	return template
+}
+
+// GetTemplates returns the recurring templates ordered by ID.
+func (sm *StateManager) GetTemplates() []config.Template {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	templates := make([]config.Template, 0, len(sm.templates))
+	for _, template := range sm.templates {
+		templates = append(templates, copyTemplate(template))
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].ID < templates[j].ID
+	})
+	return templates
+}
+
+func (sm *StateManager) GetTemplate(id string) (config.Template, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	template, ok := sm.templates[id]
+	if !ok {
+		return config.Template{}, false
+	}
+	return copyTemplate(template), true
+}
+
+// AddTemplate creates the template. The first instance is created at the
+// first scheduled time after now.
+func (sm *StateManager) AddTemplate(user string, template config.Template) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, ok := sm.templates[template.ID]; ok {
+		return ErrAlreadyExists
+	}
+	now := time.Now()
+	template.CreatedBy = user
+	template.CreatedAt = &now
+	template.LastRun = nil
+
+	_, err := sm.update(config.JournalEntry{User: user, Operation: "add-template"}, func(tx statestore.Tx) error {
+		return tx.PutTemplate(template)
+	})
+	return err
+}
+
+// UpdateTemplate replaces the template with the same ID. Already created
+// instances are not changed.
+func (sm *StateManager) UpdateTemplate(user string, template config.Template) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	old, ok := sm.templates[template.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	template.CreatedBy = old.CreatedBy
+	template.CreatedAt = old.CreatedAt
+	template.LastRun = old.LastRun
+
+	_, err := sm.update(config.JournalEntry{User: user, Operation: "update-template"}, func(tx statestore.Tx) error {
+		return tx.PutTemplate(template)
+	})
+	return err
+}
+
+// DeleteTemplate deletes the template. Its instances are kept.
+func (sm *StateManager) DeleteTemplate(user string, id string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, ok := sm.templates[id]; !ok {
+		return ErrNotFound
+	}
+	_, err := sm.update(config.JournalEntry{User: user, Operation: "delete-template"}, func(tx statestore.Tx) error {
+		return tx.DeleteTemplate(id)
+	})
+	return err
+}
+
+// lastOccurrence returns the latest scheduled time of the template that is
+// after its last run and not after now, or the zero time.
+func lastOccurrence(template config.Template, now time.Time, location *time.Location) time.Time {
+	schedule, err := calendar.ParseSchedule(template.Schedule)
+	if err != nil {
+		return time.Time{}
+	}
+	from := template.LastRun
+	if from == nil {
+		from = template.CreatedAt
+	}
+	if from == nil {
+		return time.Time{}
+	}
+	start := from.In(location)
+	if next := schedule.Next(start); next.IsZero() || next.After(now) {
+		return time.Time{}
+	}
+	// Look for an occurrence in exponentially growing windows before now,
+	// so that a long pause doesn't make us walk through every missed
+	// occurrence.
+	for d := time.Minute; now.Add(-d).After(start); d *= 2 {
+		if next := schedule.Next(now.Add(-d).In(location)); !next.IsZero() && !next.After(now) {
+			start = now.Add(-d).In(location)
+			break
+		}
+	}
+	var occurrence time.Time
+	next := schedule.Next(start)
+	for i := 0; i < maxScheduleOccurrences && !next.IsZero() && !next.After(now); i++ {
+		occurrence = next
+		next = schedule.Next(next)
+	}
+	return occurrence
+}
+
+// RunTemplates creates instances of the templates that are due, deletes
+// expired tasks that aren't done and archives expired goals. If an instance
+// was missed several times, only one instance is created.
+func (sm *StateManager) RunTemplates(now time.Time, location *time.Location) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var expiredTasks []string
+	for id, task := range sm.localTasks {
+		if task.TemplateID != "" && task.ExpiresAt != nil && !task.ExpiresAt.After(now) && !task.Status.Done() {
+			expiredTasks = append(expiredTasks, id)
+		}
+	}
+	sort.Strings(expiredTasks)
+
+	var expiredGoals []config.Goal
+	for _, goal := range sm.goals {
+		if goal.TemplateID != "" && !goal.Archived && goal.Deadline != nil && !goal.Deadline.After(now) {
+			goal.Archived = true
+			expiredGoals = append(expiredGoals, goal)
+		}
+	}
+
+	type run struct {
+		template   config.Template
+		occurrence time.Time
+	}
+	var due []run
+	for _, template := range sm.templates {
+		if occurrence := lastOccurrence(template, now, location); !occurrence.IsZero() {
+			due = append(due, run{template: copyTemplate(template), occurrence: occurrence})
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].template.ID < due[j].template.ID
+	})
+
+	if len(expiredTasks) == 0 && len(expiredGoals) == 0 && len(due) == 0 {
+		return nil
+	}
+
+	nextID := sm.lastLocalTaskID + 1
+	goalIDs := map[string]bool{}
+	for _, goal := range sm.goals {
+		goalIDs[goal.ID] = true
+	}
+	_, err := sm.update(config.JournalEntry{Operation: "run-templates"}, func(tx statestore.Tx) error {
+		for _, id := range expiredTasks {
+			if err := tx.DeleteLocalTask(id); err != nil {
+				return err
+			}
+			if _, ok := sm.tasks[localTaskID(id)]; ok {
+				if err := tx.DeleteTaskState(localTaskID(id)); err != nil {
+					return err
+				}
+			}
+		}
+		for _, goal := range expiredGoals {
+			if err := tx.PutGoal(goal); err != nil {
+				return err
+			}
+		}
+		for _, r := range due {
+			template := r.template
+			occurrence := r.occurrence
+			template.LastRun = &occurrence
+			if err := tx.PutTemplate(template); err != nil {
+				return err
+			}
+
+			var expiresAt *time.Time
+			if template.ExpireAfter != nil {
+				t := occurrence.Add(template.ExpireAfter.Duration)
+				if !t.After(now) {
+					continue
+				}
+				expiresAt = &t
+			}
+
+			created := now
+			var taskID string
+			if template.Kind == config.TemplateKindGoal {
+				id := template.ID + "-" + occurrence.Format("2006-01-02")
+				if goalIDs[id] {
+					id += occurrence.Format("-1504")
+				}
+				goalIDs[id] = true
+				goal := config.Goal{
+					ID:          id,
+					Score:       template.Score,
+					Description: template.Summary,
+					Owner:       template.Assignee,
+					Deadline:    expiresAt,
+					CreatedBy:   template.CreatedBy,
+					CreatedAt:   &created,
+					TemplateID:  template.ID,
+				}
+				if err := tx.PutGoal(goal); err != nil {
+					return err
+				}
+				taskID = goalTaskID(id)
+			} else {
+				task := config.LocalTask{
+					ID:         strconv.Itoa(nextID),
+					Summary:    template.Summary,
+					Status:     api.StatusNew,
+					Assignee:   template.Assignee,
+					Priority:   template.Priority,
+					Labels:     append(api.Labels(nil), template.Labels...),
+					CreatedBy:  template.CreatedBy,
+					CreatedAt:  &created,
+					TemplateID: template.ID,
+					ExpiresAt:  expiresAt,
+				}
+				nextID++
+				if err := tx.PutLocalTask(task); err != nil {
+					return err
+				}
+				taskID = localTaskID(task.ID)
+			}
+
+			if template.ParentID != "" {
+				taskState := config.TaskState{
+					ID:        taskID,
+					ParentID:  template.ParentID,
+					UpdatedBy: template.CreatedBy,
+					UpdatedAt: &created,
+				}
+				if err := tx.PutTaskState(taskState); err != nil {
+					return err
+				}
+			}
+		}
+		if nextID != sm.lastLocalTaskID+1 {
+			return tx.SetLastLocalTaskID(nextID - 1)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sm.lastLocalTaskID = nextID - 1
+	return nil
+}
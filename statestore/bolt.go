@@ -0,0 +1,295 @@
+package statestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dmage/gypd/config"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	goalsBucket      = []byte("goals")
+	tasksBucket      = []byte("tasks")
+	localTasksBucket = []byte("local_tasks")
+	templatesBucket  = []byte("templates")
+	plansBucket      = []byte("plans")
+	metaBucket       = []byte("meta")
+
+	versionKey         = []byte("version")
+	lastLocalTaskIDKey = []byte("last_local_task_id")
+)
+
+// Bolt stores the state in an embedded key-value database. Every goal and
+// task state is a separate record, so updates don't rewrite the whole state.
+type Bolt struct {
+	db *bolt.DB
+}
+
+func OpenBolt(filename string) (*Bolt, error) {
+	db, err := bolt.Open(filename, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		fresh := tx.Bucket(metaBucket) == nil && tx.Bucket(goalsBucket) == nil && tx.Bucket(tasksBucket) == nil
+		for _, name := range [][]byte{goalsBucket, tasksBucket, localTasksBucket, templatesBucket, plansBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if fresh {
+			return tx.Bucket(metaBucket).Put(versionKey, []byte(strconv.Itoa(config.StateVersion)))
+		}
+		return migrateBolt(tx, filename)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+func loadRawBucket(tx *bolt.Tx, bucket []byte) ([]interface{}, error) {
+	var values []interface{}
+	err := tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+		var value interface{}
+		if err := json.Unmarshal(v, &value); err != nil {
+			return fmt.Errorf("%s %s: %w", bucket, k, err)
+		}
+		values = append(values, value)
+		return nil
+	})
+	return values, err
+}
+
+// migrateBolt upgrades the database to config.StateVersion. The original
+// database is kept as filename.vN, where N is its version.
+func migrateBolt(tx *bolt.Tx, filename string) error {
+	version := 0
+	if value := tx.Bucket(metaBucket).Get(versionKey); value != nil {
+		var err error
+		version, err = strconv.Atoi(string(value))
+		if err != nil {
+			return fmt.Errorf("invalid state version %q", value)
+		}
+	}
+	if version == config.StateVersion {
+		return nil
+	}
+
+	goals, err := loadRawBucket(tx, goalsBucket)
+	if err != nil {
+		return err
+	}
+	tasks, err := loadRawBucket(tx, tasksBucket)
+	if err != nil {
+		return err
+	}
+	localTasks, err := loadRawBucket(tx, localTasksBucket)
+	if err != nil {
+		return err
+	}
+	templates, err := loadRawBucket(tx, templatesBucket)
+	if err != nil {
+		return err
+	}
+	plans, err := loadRawBucket(tx, plansBucket)
+	if err != nil {
+		return err
+	}
+	raw := map[string]interface{}{
+		"version":     float64(version),
+		"goals":       goals,
+		"tasks":       tasks,
+		"local_tasks": localTasks,
+		"templates":   templates,
+		"plans":       plans,
+	}
+	if _, err := config.MigrateState(raw); err != nil {
+		return err
+	}
+	state, err := config.DecodeRawState(raw)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.CopyFile(fmt.Sprintf("%s.v%d", filename, version), 0644); err != nil {
+		return fmt.Errorf("failed to back up state before migration: %w", err)
+	}
+	for _, name := range [][]byte{goalsBucket, tasksBucket, localTasksBucket, templatesBucket, plansBucket} {
+		if err := tx.DeleteBucket(name); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+	btx := &boltTx{tx: tx}
+	for _, goal := range state.Goals {
+		if err := btx.PutGoal(goal); err != nil {
+			return err
+		}
+	}
+	for _, taskState := range state.Tasks {
+		if err := btx.PutTaskState(taskState); err != nil {
+			return err
+		}
+	}
+	for _, task := range state.LocalTasks {
+		if err := btx.PutLocalTask(task); err != nil {
+			return err
+		}
+	}
+	for _, template := range state.Templates {
+		if err := btx.PutTemplate(template); err != nil {
+			return err
+		}
+	}
+	for _, plan := range state.Plans {
+		if err := btx.PutPlan(plan); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(metaBucket).Put(versionKey, []byte(strconv.Itoa(config.StateVersion)))
+}
+
+func (b *Bolt) Load() (*config.State, error) {
+	state := config.State{Version: config.StateVersion}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(goalsBucket).ForEach(func(k, v []byte) error {
+			var goal config.Goal
+			if err := json.Unmarshal(v, &goal); err != nil {
+				return fmt.Errorf("goal %s: %w", k, err)
+			}
+			state.Goals = append(state.Goals, goal)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(tasksBucket).ForEach(func(k, v []byte) error {
+			var taskState config.TaskState
+			if err := json.Unmarshal(v, &taskState); err != nil {
+				return fmt.Errorf("task %s: %w", k, err)
+			}
+			state.Tasks = append(state.Tasks, taskState)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(localTasksBucket).ForEach(func(k, v []byte) error {
+			var task config.LocalTask
+			if err := json.Unmarshal(v, &task); err != nil {
+				return fmt.Errorf("local task %s: %w", k, err)
+			}
+			state.LocalTasks = append(state.LocalTasks, task)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(templatesBucket).ForEach(func(k, v []byte) error {
+			var template config.Template
+			if err := json.Unmarshal(v, &template); err != nil {
+				return fmt.Errorf("template %s: %w", k, err)
+			}
+			state.Templates = append(state.Templates, template)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.Bucket(plansBucket).ForEach(func(k, v []byte) error {
+			var plan config.Plan
+			if err := json.Unmarshal(v, &plan); err != nil {
+				return fmt.Errorf("plan %s: %w", k, err)
+			}
+			state.Plans = append(state.Plans, plan)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if value := tx.Bucket(metaBucket).Get(lastLocalTaskIDKey); value != nil {
+			state.LastLocalTaskID, err = strconv.Atoi(string(value))
+			if err != nil {
+				return fmt.Errorf("invalid last local task ID %q", value)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (b *Bolt) Update(fn func(tx Tx) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltTx{tx: tx})
+	})
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (tx *boltTx) put(bucket []byte, id string, value interface{}) error {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return tx.tx.Bucket(bucket).Put([]byte(id), buf)
+}
+
+func (tx *boltTx) PutGoal(goal config.Goal) error {
+	return tx.put(goalsBucket, goal.ID, goal)
+}
+
+func (tx *boltTx) DeleteGoal(id string) error {
+	return tx.tx.Bucket(goalsBucket).Delete([]byte(id))
+}
+
+func (tx *boltTx) PutTaskState(taskState config.TaskState) error {
+	return tx.put(tasksBucket, taskState.ID, taskState)
+}
+
+func (tx *boltTx) DeleteTaskState(id string) error {
+	return tx.tx.Bucket(tasksBucket).Delete([]byte(id))
+}
+
+func (tx *boltTx) PutLocalTask(task config.LocalTask) error {
+	return tx.put(localTasksBucket, task.ID, task)
+}
+
+func (tx *boltTx) DeleteLocalTask(id string) error {
+	return tx.tx.Bucket(localTasksBucket).Delete([]byte(id))
+}
+
+func (tx *boltTx) PutTemplate(template config.Template) error {
+	return tx.put(templatesBucket, template.ID, template)
+}
+
+func (tx *boltTx) DeleteTemplate(id string) error {
+	return tx.tx.Bucket(templatesBucket).Delete([]byte(id))
+}
+
+func (tx *boltTx) PutPlan(plan config.Plan) error {
+	return tx.put(plansBucket, plan.Key(), plan)
+}
+
+func (tx *boltTx) DeletePlan(key string) error {
+	return tx.tx.Bucket(plansBucket).Delete([]byte(key))
+}
+
+func (tx *boltTx) SetLastLocalTaskID(id int) error {
+	return tx.tx.Bucket(metaBucket).Put(lastLocalTaskIDKey, []byte(strconv.Itoa(id)))
+}
@@ -0,0 +1,100 @@
+package statestore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dmage/gypd/config"
+)
+
+// Store persists the local state.
+type Store interface {
+	// Load returns the whole state.
+	Load() (*config.State, error)
+
+	// Update runs fn in a transaction. If fn returns an error, none of its
+	// changes are persisted.
+	Update(fn func(tx Tx) error) error
+
+	Close() error
+}
+
+// Tx is a set of changes to the state.
+type Tx interface {
+	PutGoal(goal config.Goal) error
+	DeleteGoal(id string) error
+	PutTaskState(taskState config.TaskState) error
+	DeleteTaskState(id string) error
+	PutLocalTask(task config.LocalTask) error
+	DeleteLocalTask(id string) error
+	PutTemplate(template config.Template) error
+	DeleteTemplate(id string) error
+	PutPlan(plan config.Plan) error
+	DeletePlan(key string) error
+	SetLastLocalTaskID(id int) error
+}
+
+// Open opens the store described by spec. The spec has the form
+// "backend:path", where backend is either "yaml" or "bolt". If the backend
+// is omitted, "yaml" is used.
+func Open(spec string) (Store, error) {
+	backend, path := "yaml", spec
+	if idx := strings.Index(spec, ":"); idx != -1 {
+		backend, path = spec[:idx], spec[idx+1:]
+	}
+	if path == "" {
+		return nil, fmt.Errorf("missing path in state store %q", spec)
+	}
+	switch backend {
+	case "yaml":
+		return OpenYAML(path)
+	case "bolt":
+		return OpenBolt(path)
+	}
+	return nil, fmt.Errorf("unknown state store backend %q", backend)
+}
+
+// Copy writes the state from src into dst, which must be empty.
+func Copy(dst, src Store) error {
+	existing, err := dst.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load destination state: %w", err)
+	}
+	if len(existing.Goals) > 0 || len(existing.Tasks) > 0 || len(existing.LocalTasks) > 0 || len(existing.Templates) > 0 || len(existing.Plans) > 0 {
+		return fmt.Errorf("destination state is not empty")
+	}
+
+	state, err := src.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load source state: %w", err)
+	}
+
+	return dst.Update(func(tx Tx) error {
+		for _, goal := range state.Goals {
+			if err := tx.PutGoal(goal); err != nil {
+				return err
+			}
+		}
+		for _, taskState := range state.Tasks {
+			if err := tx.PutTaskState(taskState); err != nil {
+				return err
+			}
+		}
+		for _, task := range state.LocalTasks {
+			if err := tx.PutLocalTask(task); err != nil {
+				return err
+			}
+		}
+		for _, template := range state.Templates {
+			if err := tx.PutTemplate(template); err != nil {
+				return err
+			}
+		}
+		for _, plan := range state.Plans {
+			if err := tx.PutPlan(plan); err != nil {
+				return err
+			}
+		}
+		return tx.SetLastLocalTaskID(state.LastLocalTaskID)
+	})
+}
@@ -0,0 +1,110 @@
+package statestore
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dmage/gypd/config"
+)
+
+func testStore(t *testing.T, store Store) {
+	err := store.Update(func(tx Tx) error {
+		if err := tx.PutGoal(config.Goal{ID: "a", Score: 1}); err != nil {
+			return err
+		}
+		if err := tx.PutGoal(config.Goal{ID: "b", Score: 2}); err != nil {
+			return err
+		}
+		if err := tx.PutTaskState(config.TaskState{ID: "rhbz:1", ParentID: "goal:a"}); err != nil {
+			return err
+		}
+		if err := tx.SetLastLocalTaskID(3); err != nil {
+			return err
+		}
+		return tx.PutTaskState(config.TaskState{ID: "rhbz:2", ParentID: "goal:b"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Update(func(tx Tx) error {
+		if err := tx.PutGoal(config.Goal{ID: "a", Score: 10}); err != nil {
+			return err
+		}
+		if err := tx.DeleteGoal("b"); err != nil {
+			return err
+		}
+		return tx.DeleteTaskState("rhbz:2")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &config.State{
+		Version: config.StateVersion,
+		Goals:   []config.Goal{{ID: "a", Score: 10}},
+		Tasks:   []config.TaskState{{ID: "rhbz:1", ParentID: "goal:a"}},
+
+		LastLocalTaskID: 3,
+	}
+	if !reflect.DeepEqual(state, expected) {
+		t.Errorf("got %+v; want %+v", state, expected)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	store, err := Open("yaml:" + filepath.Join(t.TempDir(), "state.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	testStore(t, store)
+}
+
+func TestBolt(t *testing.T) {
+	store, err := Open("bolt:" + filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	testStore(t, store)
+}
+
+func TestCopy(t *testing.T) {
+	dir := t.TempDir()
+	src, err := OpenYAML(filepath.Join(dir, "state.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, src)
+
+	dst, err := OpenBolt(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	if err := Copy(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := Copy(dst, src); err == nil {
+		t.Errorf("expected an error when copying into a non-empty store")
+	}
+
+	srcState, err := src.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstState, err := dst.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(srcState, dstState) {
+		t.Errorf("got %+v; want %+v", dstState, srcState)
+	}
+}
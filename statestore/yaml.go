@@ -0,0 +1,182 @@
+package statestore
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/dmage/gypd/config"
+)
+
+// YAML stores the state in a single YAML file that is rewritten on every
+// update.
+type YAML struct {
+	filename string
+
+	mu    sync.Mutex
+	state *config.State
+}
+
+func OpenYAML(filename string) (*YAML, error) {
+	state, err := config.LoadState(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &YAML{
+		filename: filename,
+		state:    state,
+	}, nil
+}
+
+func cloneState(state *config.State) (*config.State, error) {
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	var clone config.State
+	if err := json.Unmarshal(buf, &clone); err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
+func (y *YAML) Load() (*config.State, error) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+	return cloneState(y.state)
+}
+
+func (y *YAML) Update(fn func(tx Tx) error) error {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+
+	state, err := cloneState(y.state)
+	if err != nil {
+		return err
+	}
+	if err := fn(&yamlTx{state: state}); err != nil {
+		return err
+	}
+	if err := config.SaveState(y.filename, state); err != nil {
+		return err
+	}
+	y.state = state
+	return nil
+}
+
+func (y *YAML) Close() error {
+	return nil
+}
+
+type yamlTx struct {
+	state *config.State
+}
+
+func (tx *yamlTx) PutGoal(goal config.Goal) error {
+	for i, g := range tx.state.Goals {
+		if g.ID == goal.ID {
+			tx.state.Goals[i] = goal
+			return nil
+		}
+	}
+	tx.state.Goals = append(tx.state.Goals, goal)
+	return nil
+}
+
+func (tx *yamlTx) DeleteGoal(id string) error {
+	for i, g := range tx.state.Goals {
+		if g.ID == id {
+			tx.state.Goals = append(tx.state.Goals[:i], tx.state.Goals[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (tx *yamlTx) PutTaskState(taskState config.TaskState) error {
+	for i, ts := range tx.state.Tasks {
+		if ts.ID == taskState.ID {
+			tx.state.Tasks[i] = taskState
+			return nil
+		}
+	}
+	tx.state.Tasks = append(tx.state.Tasks, taskState)
+	return nil
+}
+
+func (tx *yamlTx) DeleteTaskState(id string) error {
+	for i, ts := range tx.state.Tasks {
+		if ts.ID == id {
+			tx.state.Tasks = append(tx.state.Tasks[:i], tx.state.Tasks[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (tx *yamlTx) PutLocalTask(task config.LocalTask) error {
+	for i, t := range tx.state.LocalTasks {
+		if t.ID == task.ID {
+			tx.state.LocalTasks[i] = task
+			return nil
+		}
+	}
+	tx.state.LocalTasks = append(tx.state.LocalTasks, task)
+	return nil
+}
+
+func (tx *yamlTx) DeleteLocalTask(id string) error {
+	for i, t := range tx.state.LocalTasks {
+		if t.ID == id {
+			tx.state.LocalTasks = append(tx.state.LocalTasks[:i], tx.state.LocalTasks[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (tx *yamlTx) PutTemplate(template config.Template) error {
+	for i, t := range tx.state.Templates {
+		if t.ID == template.ID {
+			tx.state.Templates[i] = template
+			return nil
+		}
+	}
+	tx.state.Templates = append(tx.state.Templates, template)
+	return nil
+}
+
+func (tx *yamlTx) DeleteTemplate(id string) error {
+	for i, t := range tx.state.Templates {
+		if t.ID == id {
+			tx.state.Templates = append(tx.state.Templates[:i], tx.state.Templates[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (tx *yamlTx) PutPlan(plan config.Plan) error {
+	for i, p := range tx.state.Plans {
+		if p.Key() == plan.Key() {
+			tx.state.Plans[i] = plan
+			return nil
+		}
+	}
+	tx.state.Plans = append(tx.state.Plans, plan)
+	return nil
+}
+
+func (tx *yamlTx) DeletePlan(key string) error {
+	for i, p := range tx.state.Plans {
+		if p.Key() == key {
+			tx.state.Plans = append(tx.state.Plans[:i], tx.state.Plans[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (tx *yamlTx) SetLastLocalTaskID(id int) error {
+	tx.state.LastLocalTaskID = id
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/progress"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+// syncInterval is how often the state is updated from the task sources.
+const syncInterval = 5 * time.Minute
+
+// observe loads the tasks and returns what the task sources report about
+// them. The state is not modified.
+func (s *Server) observe(cfg *config.Config) (statemanager.Observation, error) {
+	tasks, err := s.taskSource.LoadTasks(cfg)
+	if err != nil {
+		return statemanager.Observation{}, fmt.Errorf("failed to load tasks: %w", err)
+	}
+
+	var obs statemanager.Observation
+	for _, task := range tasks {
+		obs.Seen = append(obs.Seen, task.ID)
+	}
+
+	updateMarkers(tasks, s.stateManager)
+
+	for _, task := range tasks {
+		if !progress.IsDone(task) {
+			obs.Reopened = append(obs.Reopened, task.ID)
+		}
+	}
+	obs.Completions = progress.Completions(tasks)
+	return obs, nil
+}
+
+// syncState marks the tasks as seen and records their completions, so that
+// the garbage collector and the progress of goals don't depend on anyone
+// loading the task list.
+func (s *Server) syncState(cfg *config.Config) error {
+	obs, err := s.observe(cfg)
+	if err != nil {
+		return err
+	}
+	if err := s.stateManager.Observe(obs, time.Now()); err != nil {
+		return fmt.Errorf("failed to update state: %w", err)
+	}
+	return nil
+}
+
+// runSync periodically updates the state from the task sources.
+func (s *Server) runSync(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for ; true; <-ticker.C {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			logrus.Errorf("Failed to load config: %v", err)
+			continue
+		}
+		if err := s.syncState(cfg); err != nil {
+			logrus.Errorf("Failed to sync state: %v", err)
+		}
+	}
+}
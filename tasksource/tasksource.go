@@ -1,16 +1,43 @@
 package tasksource
 
 import (
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/dmage/gypd/api"
 	"github.com/dmage/gypd/config"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrUnknownTask is returned by writers when the task doesn't belong to
+	// the source.
+	ErrUnknownTask = errors.New("unknown task")
+
+	// ErrInvalidAction is returned by writers when the action can't be
+	// applied to the task.
+	ErrInvalidAction = errors.New("invalid action")
 )
 
 type TaskSource interface {
 	LoadTasks(config *config.Config) ([]*api.Task, error)
 }
 
+// TaskLoader is implemented by task sources that can load a single task.
+type TaskLoader interface {
+	LoadTask(config *config.Config, id string) (*api.Task, error)
+}
+
+// Writer is implemented by task sources that can modify tasks in the
+// upstream tracker.
+type Writer interface {
+	// ApplyAction applies the action to the task and returns a description
+	// of the change. If dryRun is true, the action is validated, but the
+	// tracker is not modified.
+	ApplyAction(config *config.Config, id string, action api.Action, dryRun bool) (string, error)
+}
+
 type Aggregated struct {
 	sources []TaskSource
 }
@@ -31,12 +58,29 @@ func (a *Aggregated) LoadTasks(cfg *config.Config) ([]*api.Task, error) {
 	return tasks, nil
 }
 
+func (a *Aggregated) ApplyAction(cfg *config.Config, id string, action api.Action, dryRun bool) (string, error) {
+	for _, s := range a.sources {
+		w, ok := s.(Writer)
+		if !ok {
+			continue
+		}
+		description, err := w.ApplyAction(cfg, id, action, dryRun)
+		if errors.Is(err, ErrUnknownTask) {
+			continue
+		}
+		return description, err
+	}
+	return "", ErrUnknownTask
+}
+
 type Cached struct {
 	source TaskSource
 	ttl    time.Duration
 
+	mu         sync.Mutex
 	tasks      []*api.Task
 	validUntil time.Time
+	stale      api.StringSet
 }
 
 func NewCached(source TaskSource, ttl time.Duration) *Cached {
@@ -54,9 +98,39 @@ func (c *Cached) tasksDeepCopy() []*api.Task {
 	return tasks
 }
 
+// refreshStale reloads the tasks that were invalidated. Tasks that fail to
+// load keep their cached copy and stay stale, so that they are retried on the
+// next call. It returns false if the source can't load individual tasks.
+func (c *Cached) refreshStale(cfg *config.Config) bool {
+	loader, ok := c.source.(TaskLoader)
+	if !ok {
+		return false
+	}
+	var failed api.StringSet
+	for i, task := range c.tasks {
+		if !c.stale.Has(task.ID) {
+			continue
+		}
+		updated, err := loader.LoadTask(cfg, task.ID)
+		if err != nil {
+			logrus.Errorf("Failed to reload task %s: %v", task.ID, err)
+			failed.Add(task.ID)
+			continue
+		}
+		c.tasks[i] = updated
+	}
+	c.stale = failed
+	return true
+}
+
 func (c *Cached) LoadTasks(cfg *config.Config) ([]*api.Task, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if time.Now().Before(c.validUntil) {
-		return c.tasksDeepCopy(), nil
+		if c.stale.Empty() || c.refreshStale(cfg) {
+			return c.tasksDeepCopy(), nil
+		}
 	}
 	tasks, err := c.source.LoadTasks(cfg)
 	if err != nil {
@@ -64,5 +138,26 @@ func (c *Cached) LoadTasks(cfg *config.Config) ([]*api.Task, error) {
 	}
 	c.tasks = tasks
 	c.validUntil = time.Now().Add(c.ttl)
+	c.stale.Reset()
 	return c.tasksDeepCopy(), nil
 }
+
+// Invalidate marks the task as stale so that it is reloaded on the next
+// call to LoadTasks.
+func (c *Cached) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stale.Add(id)
+}
+
+func (c *Cached) ApplyAction(cfg *config.Config, id string, action api.Action, dryRun bool) (string, error) {
+	w, ok := c.source.(Writer)
+	if !ok {
+		return "", ErrUnknownTask
+	}
+	description, err := w.ApplyAction(cfg, id, action, dryRun)
+	if err == nil && !dryRun {
+		c.Invalidate(id)
+	}
+	return description, err
+}
@@ -0,0 +1,105 @@
+package tasksource
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/config"
+)
+
+type fakeSource struct {
+	summary    string
+	loadTasks  int
+	loadedTask []string
+	loadErr    error
+}
+
+func (f *fakeSource) LoadTasks(cfg *config.Config) ([]*api.Task, error) {
+	f.loadTasks++
+	return []*api.Task{
+		{ID: "a", Summary: f.summary},
+		{ID: "b", Summary: f.summary},
+	}, nil
+}
+
+func (f *fakeSource) LoadTask(cfg *config.Config, id string) (*api.Task, error) {
+	f.loadedTask = append(f.loadedTask, id)
+	if f.loadErr != nil {
+		return nil, f.loadErr
+	}
+	return &api.Task{ID: id, Summary: f.summary}, nil
+}
+
+func (f *fakeSource) ApplyAction(cfg *config.Config, id string, action api.Action, dryRun bool) (string, error) {
+	if !dryRun {
+		f.summary = action.Comment
+	}
+	return "ok", nil
+}
+
+func TestCachedInvalidation(t *testing.T) {
+	source := &fakeSource{summary: "old"}
+	cached := NewCached(source, time.Hour)
+	cfg := &config.Config{}
+
+	if _, err := cached.LoadTasks(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cached.ApplyAction(cfg, "b", api.Action{Comment: "dry"}, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.ApplyAction(cfg, "b", api.Action{Comment: "new"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := cached.LoadTasks(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.loadTasks != 1 {
+		t.Errorf("LoadTasks called %d times; want 1", source.loadTasks)
+	}
+	if len(source.loadedTask) != 1 || source.loadedTask[0] != "b" {
+		t.Errorf("LoadTask called for %v; want [b]", source.loadedTask)
+	}
+	if tasks[0].Summary != "old" || tasks[1].Summary != "new" {
+		t.Errorf("got summaries %q, %q; want old, new", tasks[0].Summary, tasks[1].Summary)
+	}
+}
+
+func TestCachedInvalidationError(t *testing.T) {
+	source := &fakeSource{summary: "old"}
+	cached := NewCached(source, time.Hour)
+	cfg := &config.Config{}
+
+	if _, err := cached.LoadTasks(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.ApplyAction(cfg, "b", api.Action{Comment: "new"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	source.loadErr = errors.New("tracker is down")
+	tasks, err := cached.LoadTasks(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks[1].Summary != "old" {
+		t.Errorf("got summary %q; want the cached copy", tasks[1].Summary)
+	}
+
+	source.loadErr = nil
+	tasks, err = cached.LoadTasks(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks[1].Summary != "new" {
+		t.Errorf("got summary %q after recovery; want new", tasks[1].Summary)
+	}
+	if source.loadTasks != 1 {
+		t.Errorf("LoadTasks called %d times; want 1", source.loadTasks)
+	}
+}
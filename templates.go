@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dmage/gypd/api"
+	"github.com/dmage/gypd/auth"
+	"github.com/dmage/gypd/calendar"
+	"github.com/dmage/gypd/config"
+	"github.com/dmage/gypd/statemanager"
+	"github.com/sirupsen/logrus"
+)
+
+func validateTemplate(template config.Template) error {
+	if template.ID == "" {
+		return fmt.Errorf("missing template id")
+	}
+	if template.Kind != "" && template.Kind != config.TemplateKindTask && template.Kind != config.TemplateKindGoal {
+		return fmt.Errorf("invalid kind %q", template.Kind)
+	}
+	if _, err := calendar.ParseSchedule(template.Schedule); err != nil {
+		return err
+	}
+	if template.Kind == config.TemplateKindGoal {
+		return validateGoal(config.Goal{ID: template.ID, Owner: template.Assignee})
+	}
+	return validateLocalTask(config.LocalTask{
+		Summary:  template.Summary,
+		Status:   api.StatusNew,
+		Assignee: template.Assignee,
+		Priority: template.Priority,
+		Labels:   template.Labels,
+	})
+}
+
+// checkTemplateParent checks the parent of the future instances of the
+// template against the current task graph.
+func (s *Server) checkTemplateParent(template config.Template) error {
+	if template.ParentID == "" {
+		return nil
+	}
+	// The instances don't exist yet, so they can't have children and can't
+	// be a part of a cycle.
+	instanceID := "local:"
+	if template.Kind == config.TemplateKindGoal {
+		instanceID = "goal:" + template.ID
+	}
+	return s.checkParent(instanceID, template.ParentID)
+}
+
+// templatesInterval is how often the recurring templates are checked.
+const templatesInterval = time.Minute
+
+// runTemplates periodically creates the instances of the templates that are
+// due.
+func (s *Server) runTemplates(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for ; true; <-ticker.C {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			logrus.Errorf("Failed to load config: %v", err)
+			continue
+		}
+		cal, err := calendar.New(cfg.Calendar)
+		if err != nil {
+			logrus.Errorf("Invalid calendar: %v", err)
+			continue
+		}
+		if err := s.stateManager.RunTemplates(time.Now(), cal.Location()); err != nil {
+			logrus.Errorf("Failed to run recurring templates: %v", err)
+		}
+	}
+}
+
+func (s *Server) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.stateManager.GetTemplates())
+}
+
+func (s *Server) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := s.stateManager.GetTemplate(s.urlParam(r, "id"))
+	if !ok {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(template)
+}
+
+func (s *Server) PostTemplate(w http.ResponseWriter, r *http.Request) {
+	var template config.Template
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		logrus.Errorf("Failed to decode template: %v", err)
+		http.Error(w, "Failed to decode template", http.StatusBadRequest)
+		return
+	}
+	if err := validateTemplate(template); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.checkTemplateParent(template); errors.Is(err, errInvalidParent) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to validate parent: %v", err)
+		http.Error(w, "Failed to validate parent", http.StatusInternalServerError)
+		return
+	}
+
+	err := s.stateManager.AddTemplate(auth.User(r.Context()), template)
+	if errors.Is(err, statemanager.ErrAlreadyExists) {
+		http.Error(w, "Template already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to save template: %v", err)
+		http.Error(w, "Failed to save template", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) PutTemplate(w http.ResponseWriter, r *http.Request) {
+	var template config.Template
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		logrus.Errorf("Failed to decode template: %v", err)
+		http.Error(w, "Failed to decode template", http.StatusBadRequest)
+		return
+	}
+	template.ID = s.urlParam(r, "id")
+	if err := validateTemplate(template); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.checkTemplateParent(template); errors.Is(err, errInvalidParent) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to validate parent: %v", err)
+		http.Error(w, "Failed to validate parent", http.StatusInternalServerError)
+		return
+	}
+
+	err := s.stateManager.UpdateTemplate(auth.User(r.Context()), template)
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to save template: %v", err)
+		http.Error(w, "Failed to save template", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	err := s.stateManager.DeleteTemplate(auth.User(r.Context()), s.urlParam(r, "id"))
+	if errors.Is(err, statemanager.ErrNotFound) {
+		http.Error(w, "Template not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		logrus.Errorf("Failed to delete template: %v", err)
+		http.Error(w, "Failed to delete template", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}